@@ -0,0 +1,117 @@
+package shrub
+
+import "fmt"
+
+// Builder wraps a Configuration so that it can be built without
+// recovering from panics. Rather than panicking, invalid commands added
+// through the builder, or to the tasks and task groups that it returns,
+// are skipped and recorded; check Err once the configuration is
+// complete, in the same way as bufio.Scanner.
+//
+//	b := shrub.NewBuilder(nil)
+//	b.Function("setup", shrub.CmdGetProject{Directory: "src"})
+//	b.Task("compile").Function("setup").Command(shrub.CmdExec{Binary: "make"})
+//	b.Variant("ubuntu").AddTasks("compile")
+//	if err := b.Err(); err != nil {
+//		return err
+//	}
+//	conf := b.Configuration()
+type Builder struct {
+	conf      *Configuration
+	collector *buildCollector
+}
+
+// NewBuilder returns a builder that adds to the configuration. If the
+// configuration is nil, the builder creates a new one.
+func NewBuilder(c *Configuration) *Builder {
+	if c == nil {
+		c = &Configuration{}
+	}
+
+	return &Builder{conf: c, collector: &buildCollector{}}
+}
+
+// Configuration returns the configuration being built.
+func (b *Builder) Configuration() *Configuration { return b.conf }
+
+// Task returns the task of the specified name, creating it if
+// necessary. Invalid commands added to the task are recorded by the
+// builder rather than causing a panic, including when the task is
+// later fetched from the configuration itself (e.g. with
+// Configuration.Task). Tasks that were never returned by the builder
+// panic as usual.
+func (b *Builder) Task(name string) *Task {
+	t := b.conf.Task(name)
+	t.collector = b.collector
+	return t
+}
+
+// TaskGroup returns the task group of the specified name, creating it
+// if necessary. Invalid commands added to the task group are recorded
+// by the builder rather than causing a panic, in the same way as Task.
+func (b *Builder) TaskGroup(name string) *TaskGroup {
+	g := b.conf.TaskGroup(name)
+	g.collector = b.collector
+	return g
+}
+
+// Variant returns the build variant of the specified name, creating it
+// if necessary.
+func (b *Builder) Variant(name string) *Variant { return b.conf.Variant(name) }
+
+// Function adds the commands to the function of the specified name,
+// creating it if necessary, and returns the function's command
+// sequence. Invalid commands are recorded by the builder and are not
+// added to the function.
+func (b *Builder) Function(name string, cmds ...Command) *CommandSequence {
+	return b.add(b.conf.Function(name), fmt.Sprintf("functions[%s]", name), cmds)
+}
+
+// Pre adds the commands to the project's pre commands, which run before
+// every task, and returns the sequence. Invalid commands are recorded
+// by the builder and are not added.
+func (b *Builder) Pre(cmds ...Command) *CommandSequence {
+	return b.add(b.conf.Pre(), "pre", cmds)
+}
+
+// Post adds the commands to the project's post commands, which run
+// after every task, and returns the sequence. Invalid commands are
+// recorded by the builder and are not added.
+func (b *Builder) Post(cmds ...Command) *CommandSequence {
+	return b.add(b.conf.Post(), "post", cmds)
+}
+
+// Timeout adds the commands to the project's timeout commands, which
+// run when a task times out, and returns the sequence. Invalid commands
+// are recorded by the builder and are not added.
+func (b *Builder) Timeout(cmds ...Command) *CommandSequence {
+	return b.add(b.conf.Timeout(), "timeout", cmds)
+}
+
+func (b *Builder) add(seq *CommandSequence, path string, cmds []Command) *CommandSequence {
+	start := len(*seq)
+	for idx, cmd := range cmds {
+		def, err := ResolveCommand(cmd)
+		if err != nil {
+			b.collector.fail(BuildFailure{
+				Path:    fmt.Sprintf("%s[%d]", path, start+idx),
+				Command: commandName(cmd),
+				Cause:   err,
+			})
+			continue
+		}
+		*seq = append(*seq, def)
+	}
+
+	return seq
+}
+
+// Err returns a *BuildError describing every invalid command added
+// through the builder, or nil if there were none.
+func (b *Builder) Err() error {
+	if len(b.collector.failures) == 0 {
+		return nil
+	}
+
+	return &BuildError{Failures: append([]BuildFailure{}, b.collector.failures...)}
+}
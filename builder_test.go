@@ -0,0 +1,102 @@
+package shrub
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		defer catch(t, "valid builder")
+
+		b := NewBuilder(nil)
+		b.Function("setup", CmdGetProject{Directory: "src"})
+		b.Task("compile").Function("setup").Command(CmdExec{Binary: "make"})
+		b.TaskGroup("group").Task("compile").SetupTaskCommand(CmdExec{Binary: "true"})
+		b.Variant("ubuntu").AddTasks("group")
+
+		require(t, b.Err() == nil, errString(b.Err()))
+		conf := b.Configuration()
+		assert(t, len(conf.Tasks) == 1 && len(conf.Tasks[0].Commands) == 2)
+		assert(t, len(*conf.Functions["setup"]) == 1)
+		assert(t, len(conf.Groups[0].SetupTask) == 1)
+		assert(t, conf.Validate() == nil, errString(conf.Validate()))
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		defer catch(t, "invalid builder")
+
+		cause := errors.New("bad command")
+		b := NewBuilder(nil)
+		b.Function("setup", CmdGetProject{Directory: "src"}, failingCmd{err: cause})
+		b.Task("compile").Command(CmdS3Put{}, CmdExec{Binary: "make"})
+		b.TaskGroup("group").TimeoutCommand(CmdArchiveCreate{Format: "rar"}).
+			TeardownGroupCommand(CmdExec{Binary: "true"})
+		b.Post(CmdExec{Binary: "true"}, CmdExecShell{})
+
+		err := b.Err()
+		require(t, err != nil)
+		var buildErr *BuildError
+		require(t, errors.As(err, &buildErr))
+		require(t, len(buildErr.Failures) == 4, err.Error())
+		assert(t, errors.Is(err, cause))
+		assert(t, strings.Contains(err.Error(), "functions[setup][1] (failing): bad command"), err.Error())
+		assert(t, strings.Contains(err.Error(), "tasks[compile].commands[0] (s3.put)"), err.Error())
+		assert(t, strings.Contains(err.Error(), "task_groups[group].timeout[0]"), err.Error())
+		assert(t, strings.Contains(err.Error(), "post[1] (shell.exec)"), err.Error())
+
+		conf := b.Configuration()
+		assert(t, len(*conf.Functions["setup"]) == 1, "invalid commands are skipped")
+		assert(t, len(conf.Tasks[0].Commands) == 1)
+		assert(t, len(conf.Groups[0].Timeout) == 0 && len(conf.Groups[0].TeardownGroup) == 1)
+		assert(t, len(conf.PostCommands) == 1)
+	})
+	t.Run("ExistingConfiguration", func(t *testing.T) {
+		defer catch(t, "existing configuration")
+
+		conf := &Configuration{}
+		conf.Task("compile").Command(CmdExec{Binary: "make"})
+
+		b := NewBuilder(conf)
+		b.Task("compile").Command(CmdS3Put{})
+		assert(t, b.Configuration() == conf)
+		assert(t, b.Err() != nil)
+		assert(t, len(conf.Tasks[0].Commands) == 1)
+	})
+	t.Run("ConfigurationIsNotCollected", func(t *testing.T) {
+		conf := &Configuration{}
+		b := NewBuilder(conf)
+		b.Task("compile").Command(CmdS3Put{})
+		b.TaskGroup("group").SetupGroupCommand(CmdS3Put{})
+		require(t, b.Err() != nil)
+
+		func() {
+			defer catch(t, "tasks fetched from the configuration stay attached to the builder")
+			b.Configuration().Task("compile").Command(CmdS3Put{})
+			conf.TaskGroup("group").SetupGroupCommand(CmdS3Put{})
+		}()
+		func() {
+			defer expect(t, "new tasks panic")
+			conf.Task("lint").Command(CmdS3Put{})
+		}()
+		func() {
+			defer expect(t, "new task groups panic")
+			conf.TaskGroup("other").SetupGroupCommand(CmdS3Put{})
+		}()
+		assert(t, len(b.Err().(*BuildError).Failures) == 4)
+	})
+}
+
+func TestResolveCommand(t *testing.T) {
+	defer catch(t, "resolve command")
+
+	def, err := ResolveCommand(CmdExec{Binary: "make"})
+	require(t, err == nil, errString(err))
+	assert(t, def.CommandName == "subprocess.exec")
+
+	for _, cmd := range []Command{nil, CmdS3Put{}, CmdArchiveCreate{Format: "rar"}, failingCmd{err: errors.New("bad")}} {
+		def, err = ResolveCommand(cmd)
+		assert(t, err != nil)
+		assert(t, def == nil)
+	}
+}
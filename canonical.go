@@ -0,0 +1,123 @@
+package shrub
+
+import "sort"
+
+// Canonicalize puts the configuration into a canonical order, so that
+// equivalent configurations serialize to identical output regardless of
+// the order in which they were built. It sorts modules, tasks, task
+// groups and variants by name; sorts each variant's task specs, display
+// tasks (and their execution tasks) and modules; sorts dependency lists
+// and allowed requesters; and sorts and de-duplicates tags.
+//
+// Orderings that are significant to Evergreen are preserved: commands,
+// the tasks within a task group, ignored file patterns, and run_on
+// lists (in which the first distro is the primary one) are left as they
+// are. Maps, such as functions and expansions, do not need to be
+// sorted, because both the JSON and YAML encoders write map keys in
+// sorted order.
+//
+// Canonicalize modifies the configuration in place and returns it.
+func (c *Configuration) Canonicalize() *Configuration {
+	sort.SliceStable(c.Modules, func(i, j int) bool { return moduleName(c.Modules[i]) < moduleName(c.Modules[j]) })
+
+	sort.SliceStable(c.Tasks, func(i, j int) bool { return taskName(c.Tasks[i]) < taskName(c.Tasks[j]) })
+	for _, t := range c.Tasks {
+		if t == nil {
+			continue
+		}
+		t.Tags = canonicalTags(t.Tags)
+		sortDependencies(t.Dependencies)
+		sort.Strings(t.AllowedRequesters)
+	}
+
+	sort.SliceStable(c.Groups, func(i, j int) bool { return groupName(c.Groups[i]) < groupName(c.Groups[j]) })
+	for _, g := range c.Groups {
+		if g != nil {
+			g.Tags = canonicalTags(g.Tags)
+		}
+	}
+
+	sort.SliceStable(c.Variants, func(i, j int) bool { return variantName(c.Variants[i]) < variantName(c.Variants[j]) })
+	for _, v := range c.Variants {
+		if v == nil {
+			continue
+		}
+		v.Tags = canonicalTags(v.Tags)
+		sortDependencies(v.DependsOn)
+		sort.Strings(v.AllowedRequesters)
+		sort.Strings(v.Modules)
+
+		sort.SliceStable(v.TaskSpecs, func(i, j int) bool { return v.TaskSpecs[i].Name < v.TaskSpecs[j].Name })
+		for idx := range v.TaskSpecs {
+			spec := &v.TaskSpecs[idx]
+			sortDependencies(spec.DependsOn)
+			sort.Strings(spec.AllowedRequesters)
+			if spec.TaskGroup != nil {
+				spec.TaskGroup.Tags = canonicalTags(spec.TaskGroup.Tags)
+			}
+		}
+
+		sort.SliceStable(v.DisplayTaskSpecs, func(i, j int) bool { return v.DisplayTaskSpecs[i].Name < v.DisplayTaskSpecs[j].Name })
+		for _, dt := range v.DisplayTaskSpecs {
+			sort.Strings(dt.Components)
+		}
+	}
+
+	return c
+}
+
+func moduleName(m *Module) string {
+	if m == nil {
+		return ""
+	}
+	return m.ModuleName
+}
+
+func taskName(t *Task) string {
+	if t == nil {
+		return ""
+	}
+	return t.Name
+}
+
+func groupName(g *TaskGroup) string {
+	if g == nil {
+		return ""
+	}
+	return g.GroupName
+}
+
+func variantName(v *Variant) string {
+	if v == nil {
+		return ""
+	}
+	return v.BuildName
+}
+
+// canonicalTags returns the tags sorted and without duplicates.
+func canonicalTags(tags []string) []string {
+	if len(tags) == 0 {
+		return tags
+	}
+
+	sort.Strings(tags)
+	out := tags[:1]
+	for _, tag := range tags[1:] {
+		if tag != out[len(out)-1] {
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+func sortDependencies(deps []TaskDependency) {
+	sort.SliceStable(deps, func(i, j int) bool {
+		if deps[i].Name != deps[j].Name {
+			return deps[i].Name < deps[j].Name
+		}
+		if deps[i].Variant != deps[j].Variant {
+			return deps[i].Variant < deps[j].Variant
+		}
+		return deps[i].Status < deps[j].Status
+	})
+}
@@ -0,0 +1,86 @@
+package shrub
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	t.Run("Empty", func(t *testing.T) {
+		conf := &Configuration{}
+		assert(t, conf.Canonicalize() == conf)
+		assert(t, conf.isEmpty())
+	})
+	t.Run("Ordering", func(t *testing.T) {
+		conf := &Configuration{}
+		conf.Task("test").Tag("unit", "fast", "unit").
+			Dependency(TaskDependency{Name: "lint"}, TaskDependency{Name: "compile", Variant: "windows"}, TaskDependency{Name: "compile"})
+		conf.Task("compile").Function("setup", "build")
+		conf.TaskGroup("group").Task("test", "compile")
+		conf.Variant("windows").RunOn("windows-large").AddTasks("test", "compile").
+			SetTags("b", "a", "b").
+			DisplayTasks(DisplayTaskDefinition{Name: "all", Components: []string{"test", "compile"}})
+		conf.Variant("ubuntu").AddTasks("compile").Module("tools").Module("docs")
+		conf.Variant("ubuntu").DistroRunOn = []string{"ubuntu-large", "ubuntu-small"}
+
+		conf.Canonicalize()
+
+		require(t, len(conf.Tasks) == 2)
+		assert(t, conf.Tasks[0].Name == "compile")
+		assert(t, strings.Join(conf.Tasks[1].Tags, ",") == "fast,unit", "tags are sorted and deduplicated")
+
+		deps := conf.Tasks[1].Dependencies
+		require(t, len(deps) == 3)
+		assert(t, deps[0].Name == "compile" && deps[0].Variant == "")
+		assert(t, deps[1].Name == "compile" && deps[1].Variant == "windows")
+		assert(t, deps[2].Name == "lint")
+
+		assert(t, conf.Tasks[0].Commands[0].FunctionName == "setup", "commands keep their order")
+		assert(t, strings.Join(conf.Groups[0].Tasks, ",") == "test,compile", "task group members keep their order")
+
+		require(t, len(conf.Variants) == 2)
+		ubuntu, windows := conf.Variants[0], conf.Variants[1]
+		assert(t, ubuntu.BuildName == "ubuntu")
+		assert(t, strings.Join(ubuntu.DistroRunOn, ",") == "ubuntu-large,ubuntu-small", "run_on keeps its order")
+		assert(t, strings.Join(ubuntu.Modules, ",") == "docs,tools")
+		assert(t, strings.Join(windows.Tags, ",") == "a,b")
+		assert(t, windows.TaskSpecs[0].Name == "compile" && windows.TaskSpecs[1].Name == "test")
+		assert(t, strings.Join(windows.DisplayTaskSpecs[0].Components, ",") == "compile,test")
+	})
+	t.Run("ByteStable", func(t *testing.T) {
+		build := func(reverse bool) *Configuration {
+			conf := &Configuration{}
+			names := []string{"a", "b", "c", "d"}
+			if reverse {
+				names = []string{"d", "c", "b", "a"}
+			}
+			for _, name := range names {
+				conf.Task(name).Tag("all", name)
+				conf.Function("fn-"+name).Command().Command("shell.exec").Param("script", name)
+				conf.Variant("v-"+name).AddTasks(names...).Expansion("name", name).Expansion("kind", "test")
+			}
+			return conf.Canonicalize()
+		}
+
+		for _, format := range []Format{JSON, YAML} {
+			first, err := build(false).Marshal(format)
+			require(t, err == nil, errString(err))
+			second, err := build(true).Marshal(format)
+			require(t, err == nil, errString(err))
+			assert(t, string(first) == string(second), string(format), "output is not stable")
+		}
+	})
+	t.Run("Idempotent", func(t *testing.T) {
+		conf := &Configuration{}
+		conf.Function("setup").Command().Command("git.get_project").Param("directory", "src")
+		conf.Task("test").Function("setup").Dependency(TaskDependency{Name: "compile"}).Tag("unit", "fast")
+		conf.Task("compile").Function("setup")
+		conf.Variant("ubuntu").Expansion("b", "two").Expansion("a", 1).AddTasks("test", "compile")
+		conf.Canonicalize()
+		first, err := conf.Marshal(JSON)
+		require(t, err == nil, errString(err))
+		second, err := conf.Canonicalize().Marshal(JSON)
+		require(t, err == nil, errString(err))
+		assert(t, string(first) == string(second))
+	})
+}
@@ -0,0 +1,119 @@
+package shrub
+
+import "reflect"
+
+// Clone returns a deep copy of the configuration, so that modifying the
+// copy (e.g. with the fluent builders) does not modify the original.
+// The copy, and its tasks and task groups, do not report invalid
+// commands to the original's BuildConfigurationCollect or Builder.
+func (c *Configuration) Clone() *Configuration {
+	out := deepCopy(c)
+	if out != nil {
+		out.stopCollecting()
+	}
+	return out
+}
+
+// Clone returns a deep copy of the task, which does not report invalid
+// commands to the original's BuildConfigurationCollect or Builder.
+func (t *Task) Clone() *Task {
+	out := deepCopy(t)
+	if out != nil {
+		out.collector = nil
+	}
+	return out
+}
+
+// Clone returns a deep copy of the task group, which does not report
+// invalid commands to the original's BuildConfigurationCollect or
+// Builder.
+func (g *TaskGroup) Clone() *TaskGroup {
+	out := deepCopy(g)
+	if out != nil {
+		out.collector = nil
+	}
+	return out
+}
+
+// Clone returns a deep copy of the build variant, including its task
+// specs, expansions and display tasks. Task groups defined inline in
+// the copy's task specs do not report invalid commands to the
+// original's BuildConfigurationCollect or Builder.
+func (v *Variant) Clone() *Variant {
+	out := deepCopy(v)
+	if out != nil {
+		out.stopCollecting()
+	}
+	return out
+}
+
+// Clone returns a deep copy of the command, including its params and
+// vars.
+func (c *CommandDefinition) Clone() *CommandDefinition { return deepCopy(c) }
+
+// Clone returns a deep copy of the sequence and each of its commands.
+func (s CommandSequence) Clone() CommandSequence { return deepCopy(s) }
+
+// deepCopy copies every map, slice and pointer reachable from the
+// exported fields of the value. Unexported fields, such as the collector
+// of build failures, are shared with the original unless the caller
+// clears them.
+func deepCopy[T any](val T) T {
+	out, _ := copyValue(reflect.ValueOf(&val).Elem()).Interface().(T)
+	return out
+}
+
+func copyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), copyValue(iter.Value()))
+		}
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return out
+	case reflect.Array:
+		out := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return out
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(copyValue(v.Elem()))
+		return out
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.Set(copyValue(v.Elem()))
+		return out
+	case reflect.Struct:
+		out := reflect.New(v.Type()).Elem()
+		out.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if out.Field(i).CanSet() {
+				out.Field(i).Set(copyValue(v.Field(i)))
+			}
+		}
+		return out
+	default:
+		return v
+	}
+}
@@ -0,0 +1,145 @@
+package shrub
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClone(t *testing.T) {
+	t.Run("Task", func(t *testing.T) {
+		task := (&Task{Name: "test"}).
+			FunctionWithVars("run", map[string]string{"suite": "unit"}).
+			Command(CmdExec{Binary: "make", Args: []string{"test"}}).
+			Dependency(TaskDependency{Name: "compile"}).
+			Tag("tests").
+			Stepback(true)
+		task.Dependencies[0].SetPatchOptional(true)
+
+		clone := task.Clone()
+		require(t, clone != task)
+		assert(t, reflect.DeepEqual(clone, task))
+
+		clone.Tag("slow").Function("cleanup").Stepback(false)
+		clone.Commands[0].Var("suite", "integration")
+		clone.Commands[1].Params["args"].([]interface{})[0] = "lint"
+		clone.Dependencies[0].SetPatchOptional(false)
+
+		assert(t, len(task.Tags) == 1)
+		assert(t, len(task.Commands) == 2)
+		assert(t, *task.CanStepback)
+		assert(t, task.Commands[0].Vars["suite"] == "unit")
+		assert(t, task.Commands[1].Params["args"].([]interface{})[0] == "test")
+		assert(t, *task.Dependencies[0].PatchOptional)
+	})
+	t.Run("Variant", func(t *testing.T) {
+		v := (&Variant{}).Name("ubuntu").
+			Expansion("flags", map[string]interface{}{"race": true}).
+			AddTasks("compile").
+			DisplayTasks(DisplayTaskDefinition{Name: "all", Components: []string{"compile"}})
+
+		clone := v.Clone()
+		assert(t, reflect.DeepEqual(clone, v))
+
+		clone.Name("windows").Expansion("goos", "windows").AddTasks("lint")
+		clone.Expansions["flags"].(map[string]interface{})["race"] = false
+		clone.DisplayTaskSpecs[0].Components[0] = "lint"
+
+		assert(t, v.BuildName == "ubuntu")
+		assert(t, len(v.Expansions) == 1)
+		assert(t, v.Expansions["flags"].(map[string]interface{})["race"] == true)
+		assert(t, len(v.TaskSpecs) == 1)
+		assert(t, v.DisplayTaskSpecs[0].Components[0] == "compile")
+	})
+	t.Run("TaskGroup", func(t *testing.T) {
+		g := (&TaskGroup{}).Name("group").Task("compile").SetupGroupCommand(CmdExec{Binary: "true"})
+
+		clone := g.Clone()
+		assert(t, reflect.DeepEqual(clone, g))
+
+		clone.Task("lint")
+		clone.SetupGroup[0].Param("binary", "false")
+
+		assert(t, len(g.Tasks) == 1)
+		assert(t, g.SetupGroup[0].Params["binary"] == "true")
+	})
+	t.Run("Configuration", func(t *testing.T) {
+		conf := &Configuration{}
+		conf.SetStepback(true).Module("tools").Repo("tools.git").Branch("main")
+		conf.Function("setup").Add(CmdExec{Binary: "true"})
+		conf.Task("compile").Function("setup")
+		conf.Variant("ubuntu").AddTasks("compile")
+
+		clone := conf.Clone()
+		assert(t, reflect.DeepEqual(clone, conf))
+
+		clone.SetStepback(false).Module("tools").Branch("dev")
+		clone.Function("setup").Add(CmdExec{Binary: "false"})
+		clone.Task("compile").Function("build")
+		clone.Variant("ubuntu").AddTasks("lint")
+		clone.Task("lint")
+
+		assert(t, *conf.Stepback)
+		assert(t, conf.Modules[0].BranchName == "main")
+		assert(t, len(*conf.Functions["setup"]) == 1)
+		assert(t, len(conf.Task("compile").Commands) == 1)
+		assert(t, len(conf.Variant("ubuntu").TaskSpecs) == 1)
+		assert(t, len(conf.Tasks) == 1)
+	})
+	t.Run("Collector", func(t *testing.T) {
+		var task *Task
+		var group *TaskGroup
+		var conf *Configuration
+		_, err := BuildConfigurationCollect(func(c *Configuration) {
+			task = c.Task("compile").Clone()
+			group = c.TaskGroup("group").Clone()
+			conf = c.Clone()
+		})
+		require(t, err == nil, errString(err))
+
+		assert(t, task.collector == nil)
+		assert(t, group.collector == nil)
+		assert(t, conf.collector == nil)
+		assert(t, conf.Tasks[0].collector == nil)
+		assert(t, conf.Groups[0].collector == nil)
+
+		b := NewBuilder(&Configuration{})
+		assert(t, b.Task("compile").Clone().collector == nil)
+		assert(t, b.TaskGroup("group").Clone().collector == nil)
+
+		spec := TaskSpec{Name: "inline"}
+		spec.SetTaskGroup(*b.TaskGroup("inline").Task("compile"))
+		v := b.Variant("ubuntu").TaskSpec(spec)
+		require(t, v.TaskSpecs[0].TaskGroup.collector != nil)
+		assert(t, v.Clone().TaskSpecs[0].TaskGroup.collector == nil)
+		assert(t, b.Configuration().Clone().Variants[0].TaskSpecs[0].TaskGroup.collector == nil)
+		assert(t, v.TaskSpecs[0].TaskGroup.collector != nil, "the original is unchanged")
+	})
+	t.Run("Array", func(t *testing.T) {
+		type pair [2]*Task
+		original := pair{{Name: "compile"}, {Name: "test", Tags: []string{"unit"}}}
+
+		clone := deepCopy(original)
+		require(t, clone[0] != original[0] && clone[1] != original[1])
+		clone[0].Name = "lint"
+		clone[1].Tags[0] = "slow"
+
+		assert(t, original[0].Name == "compile")
+		assert(t, original[1].Tags[0] == "unit")
+	})
+	t.Run("CommandSequence", func(t *testing.T) {
+		seq := CommandSequence{}
+		seq.Add(CmdExec{Binary: "true"})
+
+		clone := seq.Clone()
+		clone.Add(CmdExec{Binary: "false"})
+		clone[0].Param("binary", "false")
+
+		assert(t, len(seq) == 1)
+		assert(t, seq[0].Params["binary"] == "true")
+	})
+	t.Run("Nil", func(t *testing.T) {
+		var task *Task
+		assert(t, task.Clone() == nil)
+		assert(t, CommandSequence(nil).Clone() == nil)
+	})
+}
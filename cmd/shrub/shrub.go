@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/evergreen-ci/shrub"
+	"github.com/pkg/errors"
+)
+
+const usage = `usage: shrub <command> [arguments]
+
+Commands:
+    validate  check configuration files for internal consistency
+    fmt       rewrite configuration files in canonical order
+    convert   convert a configuration file between JSON and YAML
+    diff      report the semantic differences between two configuration files
+    explain   list the tasks that run on each build variant
+
+Run 'shrub <command> -h' for the arguments of a command.
+`
+
+// errDifferent is returned by subcommands that report a difference
+// (e.g. an invalid file or a non-empty diff) rather than a failure,
+// after the difference has already been written to the output.
+var errDifferent = errors.New("different")
+
+// shrub is a command-line tool for checking and manipulating Evergreen
+// project configuration files (and generate.tasks files) using the
+// shrub library.
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command named by the first argument and returns the
+// exit status: 0 on success, 1 if the command failed or reported a
+// difference, and 2 if the command could not be determined.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) < 1 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	commands := map[string]func(args []string, stdout, stderr io.Writer) error{
+		"validate": validate,
+		"fmt":      format,
+		"convert":  convert,
+		"diff":     diff,
+		"explain":  explain,
+	}
+
+	name := args[0]
+	if name == "-h" || name == "-help" || name == "--help" || name == "help" {
+		fmt.Fprint(stdout, usage)
+		return 0
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "shrub: unknown command '%s'\n\n%s", name, usage)
+		return 2
+	}
+
+	switch err := cmd(args[1:], stdout, stderr); {
+	case err == nil:
+	case err == flag.ErrHelp:
+	case err == errDifferent:
+		return 1
+	default:
+		fmt.Fprintf(stderr, "shrub %s: %s\n", name, err)
+		return 1
+	}
+	return 0
+}
+
+// newFlagSet returns a flag set for a subcommand that reports parse
+// errors rather than exiting.
+func newFlagSet(name, args, description string, output io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: shrub %s %s\n\n%s\n", name, args, description)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// validate checks each file and reports every problem found.
+func validate(args []string, stdout, stderr io.Writer) error {
+	var fragment bool
+	fs := newFlagSet("validate", "[-fragment] <file>...", "Check configuration files for internal consistency.", stderr)
+	fs.BoolVar(&fragment, "fragment", false, "check generate.tasks files, which may refer to functions, tasks and variants defined elsewhere in the project")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no files specified")
+	}
+
+	invalid := false
+	for _, path := range fs.Args() {
+		conf, err := shrub.ReadConfigurationFile(path)
+		if err != nil {
+			return err
+		}
+
+		check := conf.Validate
+		if fragment {
+			check = conf.ValidateFragment
+		}
+		if err := check(); err != nil {
+			invalid = true
+			for _, line := range strings.Split(err.Error(), "\n") {
+				fmt.Fprintf(stdout, "%s: %s\n", path, line)
+			}
+		}
+	}
+
+	if invalid {
+		return errDifferent
+	}
+	return nil
+}
+
+// format rewrites each file in canonical order, either to standard
+// output or in place. Content that the configuration types cannot
+// represent, such as unknown keys and YAML comments and anchors, is
+// reported, and files that contain any are not rewritten in place.
+func format(args []string, stdout, stderr io.Writer) error {
+	var write, list bool
+	fs := newFlagSet("fmt", "[-w] [-l] <file>...", "Rewrite configuration files in canonical order.", stderr)
+	fs.BoolVar(&write, "w", false, "write the result to the file instead of standard output")
+	fs.BoolVar(&list, "l", false, "list the files whose formatting differs and do not print the result")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no files specified")
+	}
+
+	lossy := []string{}
+	for _, path := range fs.Args() {
+		original, err := os.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "reading file '%s'", path)
+		}
+		f, err := shrub.FormatFromPath(path)
+		if err != nil {
+			return err
+		}
+
+		problems, err := shrub.Unsupported(original, f)
+		if err != nil {
+			return errors.Wrapf(err, "reading '%s'", path)
+		}
+		for _, problem := range problems {
+			fmt.Fprintf(stderr, "%s: %s\n", path, problem)
+		}
+
+		conf, err := shrub.ReadConfiguration(bytes.NewReader(original), f)
+		if err != nil {
+			return errors.Wrapf(err, "reading '%s'", path)
+		}
+		formatted, err := conf.Canonicalize().Marshal(f)
+		if err != nil {
+			return errors.Wrapf(err, "formatting '%s'", path)
+		}
+
+		changed := !bytes.Equal(original, formatted)
+		if list && changed {
+			fmt.Fprintln(stdout, path)
+		}
+		if write && changed {
+			if len(problems) > 0 {
+				lossy = append(lossy, path)
+				continue
+			}
+			if err := shrub.WriteConfigurationFile(path, conf); err != nil {
+				return errors.Wrapf(err, "writing file '%s'", path)
+			}
+		}
+		if !write && !list {
+			if _, err := stdout.Write(formatted); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(lossy) > 0 {
+		return errors.Errorf("not rewriting %s, which would lose the content reported above", strings.Join(lossy, ", "))
+	}
+	return nil
+}
+
+// convert writes a file in another format.
+func convert(args []string, stdout, stderr io.Writer) error {
+	var to, output string
+	fs := newFlagSet("convert", "[-to json|yaml] [-o <file>] <file>", "Convert a configuration file between JSON and YAML.", stderr)
+	fs.StringVar(&to, "to", "", "the format to convert to (defaults to the format that the input file is not in, or to that of the output file)")
+	fs.StringVar(&output, "o", "", "the file to write to (defaults to standard output)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("exactly one file must be specified")
+	}
+
+	path := fs.Arg(0)
+	conf, err := shrub.ReadConfigurationFile(path)
+	if err != nil {
+		return err
+	}
+
+	target := shrub.Format(strings.ToLower(to))
+	switch {
+	case to != "":
+		if err := target.Validate(); err != nil {
+			return err
+		}
+	case output != "":
+		if target, err = shrub.FormatFromPath(output); err != nil {
+			return err
+		}
+	default:
+		from, err := shrub.FormatFromPath(path)
+		if err != nil {
+			return err
+		}
+		target = shrub.YAML
+		if from == shrub.YAML {
+			target = shrub.JSON
+		}
+	}
+
+	if output == "" {
+		return errors.Wrapf(conf.Write(stdout, target), "writing %s", target)
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return errors.Wrapf(err, "creating file '%s'", output)
+	}
+	if err := conf.Write(f, target); err != nil {
+		_ = f.Close()
+		return errors.Wrapf(err, "writing %s", target)
+	}
+	return errors.Wrapf(f.Close(), "closing file '%s'", output)
+}
+
+// diff reports the semantic differences between two files.
+func diff(args []string, stdout, stderr io.Writer) error {
+	var asJSON bool
+	fs := newFlagSet("diff", "[-json] <old file> <new file>", "Report the semantic differences between two configuration files.\nExits with status 1 if the files differ.", stderr)
+	fs.BoolVar(&asJSON, "json", false, "write the differences as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("exactly two files must be specified")
+	}
+
+	a, err := shrub.ReadConfigurationFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := shrub.ReadConfigurationFile(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	changes := shrub.Diff(a, b)
+	if asJSON {
+		err = shrub.WriteChangesJSON(stdout, changes)
+	} else {
+		err = shrub.WriteChangesText(stdout, changes)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(changes) > 0 {
+		return errDifferent
+	}
+	return nil
+}
+
+// explain lists the tasks that run on each build variant, along with
+// their dependencies.
+func explain(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("explain", "<file>", "List the tasks that run on each build variant, along with their dependencies.", stderr)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("exactly one file must be specified")
+	}
+
+	conf, err := shrub.ReadConfigurationFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	graph := shrub.NewDependencyGraph(conf)
+	tasks := map[string][]shrub.TaskInstance{}
+	for _, ti := range graph.Instances() {
+		tasks[ti.Variant] = append(tasks[ti.Variant], ti)
+	}
+
+	for _, v := range conf.Variants {
+		if v == nil {
+			continue
+		}
+
+		header := v.BuildName
+		if v.BuildDisplayName != "" {
+			header = fmt.Sprintf("%s (%s)", v.BuildName, v.BuildDisplayName)
+		}
+		if len(v.DistroRunOn) > 0 {
+			header = fmt.Sprintf("%s on %s", header, strings.Join(v.DistroRunOn, ", "))
+		}
+		fmt.Fprintln(stdout, header)
+
+		for _, ti := range tasks[v.BuildName] {
+			deps := []string{}
+			for _, dep := range graph.Dependencies(ti) {
+				if dep.Variant == ti.Variant {
+					deps = append(deps, dep.Task)
+				} else {
+					deps = append(deps, dep.String())
+				}
+			}
+
+			if len(deps) == 0 {
+				fmt.Fprintf(stdout, "    %s\n", ti.Task)
+			} else {
+				fmt.Fprintf(stdout, "    %s (depends on %s)\n", ti.Task, strings.Join(deps, ", "))
+			}
+		}
+	}
+
+	for _, ud := range graph.Unresolved() {
+		fmt.Fprintf(stdout, "warning: %s\n", ud)
+	}
+
+	return nil
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const validProject = `tasks:
+  - name: test
+    depends_on: compile
+    commands:
+      - command: subprocess.exec
+        params:
+          binary: make
+  - name: compile
+buildvariants:
+  - name: ubuntu
+    display_name: Ubuntu
+    run_on: ubuntu2204-small
+    tasks: [test, compile]
+`
+
+const invalidProject = `buildvariants:
+  - name: ubuntu
+    tasks: [lint]
+`
+
+const lossyProject = `# the project
+variables:
+  - &compile
+    name: compile
+tasks:
+  - *compile
+`
+
+// writeFile writes the content to a file of the given name in a new
+// temporary directory and returns its path.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// runShrub runs the tool with the arguments and returns its exit status
+// and output.
+func runShrub(args ...string) (int, string, string) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run(args, stdout, stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func checkStatus(t *testing.T, code, expected int, stdout, stderr string) {
+	t.Helper()
+	if code != expected {
+		t.Fatalf("exit status %d, expected %d\nstdout:\n%s\nstderr:\n%s", code, expected, stdout, stderr)
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Run("NoCommand", func(t *testing.T) {
+		code, stdout, stderr := runShrub()
+		checkStatus(t, code, 2, stdout, stderr)
+		if !strings.HasPrefix(stderr, "usage:") {
+			t.Errorf("usage is not printed: %q", stderr)
+		}
+	})
+	t.Run("Help", func(t *testing.T) {
+		code, stdout, stderr := runShrub("help")
+		checkStatus(t, code, 0, stdout, stderr)
+		if !strings.HasPrefix(stdout, "usage:") {
+			t.Errorf("usage is not printed: %q", stdout)
+		}
+	})
+	t.Run("UnknownCommand", func(t *testing.T) {
+		code, stdout, stderr := runShrub("frobnicate")
+		checkStatus(t, code, 2, stdout, stderr)
+		if !strings.Contains(stderr, "unknown command 'frobnicate'") {
+			t.Errorf("unexpected error: %q", stderr)
+		}
+	})
+	t.Run("CommandHelp", func(t *testing.T) {
+		code, stdout, stderr := runShrub("fmt", "-h")
+		checkStatus(t, code, 0, stdout, stderr)
+		if !strings.Contains(stderr, "usage: shrub fmt") {
+			t.Errorf("usage is not printed: %q", stderr)
+		}
+	})
+	t.Run("UnknownFlag", func(t *testing.T) {
+		code, stdout, stderr := runShrub("validate", "-bogus")
+		checkStatus(t, code, 1, stdout, stderr)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		code, stdout, stderr := runShrub("validate", writeFile(t, "evergreen.yml", validProject))
+		checkStatus(t, code, 0, stdout, stderr)
+		if stdout != "" {
+			t.Errorf("unexpected output: %q", stdout)
+		}
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		path := writeFile(t, "evergreen.yml", invalidProject)
+		code, stdout, stderr := runShrub("validate", path)
+		checkStatus(t, code, 1, stdout, stderr)
+		if stdout != path+": buildvariants[ubuntu].tasks[lint]: unknown task\n" {
+			t.Errorf("unexpected output: %q", stdout)
+		}
+	})
+	t.Run("Fragment", func(t *testing.T) {
+		path := writeFile(t, "generated.json", `{
+  "tasks": [{"name": "test_0", "depends_on": [{"name": "compile"}], "commands": [{"func": "run tests"}]}],
+  "buildvariants": [{"name": "ubuntu", "tasks": [{"name": "test_0"}]}]
+}`)
+		code, stdout, stderr := runShrub("validate", path)
+		checkStatus(t, code, 1, stdout, stderr)
+
+		code, stdout, stderr = runShrub("validate", "-fragment", path)
+		checkStatus(t, code, 0, stdout, stderr)
+		if stdout != "" {
+			t.Errorf("unexpected output: %q", stdout)
+		}
+
+		code, stdout, stderr = runShrub("validate", "-fragment", writeFile(t, "generated.json", `{"tasks": [{"name": "a"}, {"name": "a"}]}`))
+		checkStatus(t, code, 1, stdout, stderr)
+	})
+	t.Run("MissingFile", func(t *testing.T) {
+		code, stdout, stderr := runShrub("validate", filepath.Join(t.TempDir(), "missing.yml"))
+		checkStatus(t, code, 1, stdout, stderr)
+	})
+	t.Run("NoFiles", func(t *testing.T) {
+		code, stdout, stderr := runShrub("validate")
+		checkStatus(t, code, 1, stdout, stderr)
+	})
+}
+
+func TestFormat(t *testing.T) {
+	t.Run("Stdout", func(t *testing.T) {
+		path := writeFile(t, "evergreen.yml", validProject)
+		code, stdout, stderr := runShrub("fmt", path)
+		checkStatus(t, code, 0, stdout, stderr)
+		if strings.Index(stdout, "name: compile") > strings.Index(stdout, "name: test") {
+			t.Errorf("tasks are not sorted:\n%s", stdout)
+		}
+		if data, _ := os.ReadFile(path); string(data) != validProject {
+			t.Error("file is modified")
+		}
+	})
+	t.Run("ListAndWrite", func(t *testing.T) {
+		path := writeFile(t, "evergreen.yml", validProject)
+		code, stdout, stderr := runShrub("fmt", "-l", "-w", path)
+		checkStatus(t, code, 0, stdout, stderr)
+		if stdout != path+"\n" {
+			t.Errorf("changed file is not listed: %q", stdout)
+		}
+
+		code, stdout, stderr = runShrub("fmt", "-l", path)
+		checkStatus(t, code, 0, stdout, stderr)
+		if stdout != "" {
+			t.Errorf("rewritten file is listed: %q", stdout)
+		}
+	})
+	t.Run("RefusesLossyRewrite", func(t *testing.T) {
+		path := writeFile(t, "evergreen.yml", lossyProject)
+		code, stdout, stderr := runShrub("fmt", "-w", path)
+		checkStatus(t, code, 1, stdout, stderr)
+		for _, msg := range []string{"variables: unknown key", "comments are not preserved", "anchors and aliases are expanded", "not rewriting"} {
+			if !strings.Contains(stderr, msg) {
+				t.Errorf("missing %q in %q", msg, stderr)
+			}
+		}
+		if data, _ := os.ReadFile(path); string(data) != lossyProject {
+			t.Error("file is modified")
+		}
+	})
+	t.Run("ReportsLossyContent", func(t *testing.T) {
+		code, stdout, stderr := runShrub("fmt", writeFile(t, "evergreen.yml", lossyProject))
+		checkStatus(t, code, 0, stdout, stderr)
+		if !strings.Contains(stderr, "variables: unknown key") {
+			t.Errorf("unknown key is not reported: %q", stderr)
+		}
+	})
+	t.Run("MalformedFile", func(t *testing.T) {
+		code, stdout, stderr := runShrub("fmt", writeFile(t, "evergreen.yml", "tasks: {"))
+		checkStatus(t, code, 1, stdout, stderr)
+	})
+}
+
+func TestConvert(t *testing.T) {
+	t.Run("Stdout", func(t *testing.T) {
+		code, stdout, stderr := runShrub("convert", writeFile(t, "evergreen.yml", validProject))
+		checkStatus(t, code, 0, stdout, stderr)
+		if !json.Valid([]byte(stdout)) {
+			t.Errorf("output is not json: %q", stdout)
+		}
+	})
+	t.Run("OutputFile", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "evergreen.yaml")
+		code, stdout, stderr := runShrub("convert", "-o", output, writeFile(t, "evergreen.json", `{"tasks": [{"name": "compile"}]}`))
+		checkStatus(t, code, 0, stdout, stderr)
+		if data, _ := os.ReadFile(output); !strings.Contains(string(data), "- name: compile") {
+			t.Errorf("unexpected output: %q", data)
+		}
+	})
+	t.Run("UnwritableOutput", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "missing", "evergreen.json")
+		code, stdout, stderr := runShrub("convert", "-o", output, writeFile(t, "evergreen.yml", validProject))
+		checkStatus(t, code, 1, stdout, stderr)
+	})
+	t.Run("InvalidFormat", func(t *testing.T) {
+		code, stdout, stderr := runShrub("convert", "-to", "toml", writeFile(t, "evergreen.yml", validProject))
+		checkStatus(t, code, 1, stdout, stderr)
+	})
+	t.Run("NoFile", func(t *testing.T) {
+		code, stdout, stderr := runShrub("convert")
+		checkStatus(t, code, 1, stdout, stderr)
+	})
+}
+
+func TestDiff(t *testing.T) {
+	t.Run("Same", func(t *testing.T) {
+		path := writeFile(t, "evergreen.yml", validProject)
+		code, stdout, stderr := runShrub("diff", path, path)
+		checkStatus(t, code, 0, stdout, stderr)
+	})
+	t.Run("Different", func(t *testing.T) {
+		a := writeFile(t, "a.yml", validProject)
+		b := writeFile(t, "b.yml", invalidProject)
+		code, stdout, stderr := runShrub("diff", a, b)
+		checkStatus(t, code, 1, stdout, stderr)
+		if stdout == "" {
+			t.Error("differences are not reported")
+		}
+
+		code, stdout, stderr = runShrub("diff", "-json", a, b)
+		checkStatus(t, code, 1, stdout, stderr)
+		if !json.Valid([]byte(stdout)) {
+			t.Errorf("output is not json: %q", stdout)
+		}
+	})
+	t.Run("OneFile", func(t *testing.T) {
+		code, stdout, stderr := runShrub("diff", writeFile(t, "evergreen.yml", validProject))
+		checkStatus(t, code, 1, stdout, stderr)
+	})
+}
+
+func TestExplain(t *testing.T) {
+	t.Run("Tasks", func(t *testing.T) {
+		code, stdout, stderr := runShrub("explain", writeFile(t, "evergreen.yml", validProject))
+		checkStatus(t, code, 0, stdout, stderr)
+		expected := "ubuntu (Ubuntu) on ubuntu2204-small\n    test (depends on compile)\n    compile\n"
+		if stdout != expected {
+			t.Errorf("unexpected output:\n%s", stdout)
+		}
+	})
+	t.Run("Unresolved", func(t *testing.T) {
+		code, stdout, stderr := runShrub("explain", writeFile(t, "evergreen.yml", `tasks:
+  - name: test
+    depends_on: compile
+buildvariants:
+  - name: ubuntu
+    tasks: [test]
+`))
+		checkStatus(t, code, 0, stdout, stderr)
+		if !strings.Contains(stdout, "warning: ubuntu/test depends on ubuntu/compile") {
+			t.Errorf("unresolved dependency is not reported:\n%s", stdout)
+		}
+	})
+	t.Run("NoFile", func(t *testing.T) {
+		code, stdout, stderr := runShrub("explain")
+		checkStatus(t, code, 1, stdout, stderr)
+	})
+}
@@ -1,6 +1,11 @@
 package shrub
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
 	"sync"
 	"time"
 )
@@ -41,11 +46,12 @@ func init() {
 		timeoutUpdateFactory,
 		githubGenerateTokenFactory,
 		testSelectionGetFactory,
+		generateTasksFactory,
 	}
-	registeredCommands.mu.Lock()
-	defer registeredCommands.mu.Unlock()
 	for _, factory := range toRegister {
-		registeredCommands.commands[factory().Name()] = factory
+		if err := registeredCommands.register(factory, false); err != nil {
+			panic(err)
+		}
 	}
 }
 
@@ -62,6 +68,32 @@ type commandRegistry struct {
 
 type commandFactory func() Command
 
+func (r *commandRegistry) register(factory commandFactory, override bool) error {
+	if factory == nil {
+		return errors.New("cannot register a nil command factory")
+	}
+
+	cmd := factory()
+	if cmd == nil {
+		return errors.New("command factory produced a nil command")
+	}
+
+	name := cmd.Name()
+	if name == "" {
+		return fmt.Errorf("command %T has no name", cmd)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.commands[name]; ok && !override {
+		return fmt.Errorf("command '%s' is already registered", name)
+	}
+
+	r.commands[name] = factory
+	return nil
+}
+
 type CommandDefinition struct {
 	FunctionName        string                 `json:"func,omitempty" yaml:"func,omitempty"`
 	ExecutionType       string                 `json:"type,omitempty" yaml:"type,omitempty"`
@@ -98,6 +130,50 @@ func (c *CommandDefinition) ReplaceParams(v map[string]interface{}) *CommandDefi
 	return c
 }
 
+// Typed converts the definition into the typed Command registered for
+// its command name, decoding the parameters into the concrete command
+// struct and validating the result. It returns an error if the
+// definition is a function call, if the command is not registered, or
+// if the parameters do not describe a valid command.
+func (c *CommandDefinition) Typed() (Command, error) {
+	if c.FunctionName != "" {
+		return nil, fmt.Errorf("cannot convert call to function '%s' into a command", c.FunctionName)
+	}
+
+	cmd := GetCommand(c.CommandName)
+	if cmd == nil {
+		return nil, fmt.Errorf("'%s' is not a registered command", c.CommandName)
+	}
+
+	payload, err := json.Marshal(c.Params)
+	if err != nil {
+		return nil, fmt.Errorf("encoding params for '%s': %w", c.CommandName, err)
+	}
+
+	// Decode into a copy of the factory's product so that fields not
+	// represented in the params (e.g. an archive format) are retained.
+	target := reflect.ValueOf(cmd)
+	isPtr := target.Kind() == reflect.Ptr
+	if !isPtr {
+		target = reflect.New(target.Type())
+		target.Elem().Set(reflect.ValueOf(cmd))
+	}
+
+	if err = json.Unmarshal(payload, target.Interface()); err != nil {
+		return nil, fmt.Errorf("decoding params for '%s': %w", c.CommandName, err)
+	}
+
+	if !isPtr {
+		cmd = target.Elem().Interface().(Command)
+	}
+
+	if err = cmd.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid '%s' command: %w", c.CommandName, err)
+	}
+
+	return cmd, nil
+}
+
 func (c *CommandDefinition) Param(k string, v interface{}) *CommandDefinition {
 	if c.Params == nil {
 		c.Params = make(map[string]interface{})
@@ -110,8 +186,7 @@ func (c *CommandDefinition) Param(k string, v interface{}) *CommandDefinition {
 
 func (c *CommandDefinition) ExtendParams(p map[string]interface{}) *CommandDefinition {
 	if c.Params == nil {
-		c.Params = p
-		return c
+		c.Params = make(map[string]interface{}, len(p))
 	}
 
 	for k, v := range p {
@@ -132,13 +207,11 @@ func (c *CommandDefinition) Var(k, v string) *CommandDefinition {
 
 func (c *CommandDefinition) ExtendVars(vars map[string]string) *CommandDefinition {
 	if c.Vars == nil {
-		c.Vars = vars
-		return c
+		c.Vars = make(map[string]string, len(vars))
 	}
 
 	for k, v := range vars {
 		c.Vars[k] = v
-
 	}
 
 	return c
@@ -170,6 +243,36 @@ func (s *CommandSequence) Extend(cmds ...Command) *CommandSequence {
 	return s
 }
 
+// RegisterCommand adds a command type to the registry, so that it can
+// be produced by GetCommand and decoded by CommandDefinition.Typed. The
+// factory must produce a command with a non-empty name that is not
+// already registered; use OverrideCommand to replace an existing
+// registration.
+func RegisterCommand(factory func() Command) error {
+	return registeredCommands.register(factory, false)
+}
+
+// OverrideCommand adds a command type to the registry, replacing any
+// existing registration for a command of the same name.
+func OverrideCommand(factory func() Command) error {
+	return registeredCommands.register(factory, true)
+}
+
+// RegisteredCommands returns the names of all registered commands in
+// sorted order.
+func RegisteredCommands() []string {
+	registeredCommands.mu.RLock()
+	defer registeredCommands.mu.RUnlock()
+
+	names := make([]string, 0, len(registeredCommands.commands))
+	for name := range registeredCommands.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
 func GetCommand(cmdName string) Command {
 	registeredCommands.mu.RLock()
 	defer registeredCommands.mu.RUnlock()
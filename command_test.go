@@ -1,7 +1,9 @@
 package shrub
 
 import (
+	"errors"
 	"reflect"
+	"sort"
 	"testing"
 	"time"
 )
@@ -179,6 +181,18 @@ func TestCommandDefinition(t *testing.T) {
 			assert(t, c2 == cmd, "chainable")
 			assert(t, len(cmd.Params) == 2, "values set")
 		},
+		"ExtendVarCopiesMap": func(t *testing.T, cmd *CommandDefinition) {
+			vars := map[string]string{"a": "b"}
+			cmd.ExtendVars(vars).Var("c", "d")
+			assert(t, len(vars) == 1, "caller's map is not modified")
+			assert(t, len(cmd.Vars) == 2)
+		},
+		"ExtendParamCopiesMap": func(t *testing.T, cmd *CommandDefinition) {
+			params := map[string]interface{}{"a": true}
+			cmd.ExtendParams(params).Param("b", 42)
+			assert(t, len(params) == 1, "caller's map is not modified")
+			assert(t, len(cmd.Params) == 2)
+		},
 		"ExtendVarWithExistingOverride": func(t *testing.T, cmd *CommandDefinition) {
 			cmd.Vars = map[string]string{"a": "b"}
 			c2 := cmd.ExtendVars(map[string]string{"a": "boo", "b": "eep"})
@@ -249,7 +263,7 @@ func TestCommandSequence(t *testing.T) {
 			assert(t, s2 != nil)
 		},
 		"AddCommand": func(t *testing.T, s *CommandSequence) {
-			s2 := s.Add(CmdExec{})
+			s2 := s.Add(CmdExec{Binary: "true"})
 			assert(t, s2 != nil)
 			require(t, s.Len() == 1, "populated")
 			assert(t, s == s2, "chain holds")
@@ -278,7 +292,7 @@ func TestCommandSequence(t *testing.T) {
 			assert(t, s2 != nil)
 		},
 		"ExtendWithMultipleValidCommands": func(t *testing.T, s *CommandSequence) {
-			s2 := s.Extend(CmdExec{}, CmdExec{})
+			s2 := s.Extend(CmdExec{Binary: "true"}, CmdExec{Binary: "true"})
 			assert(t, s2 != nil)
 			require(t, s.Len() == 2, "populated")
 			assert(t, s == s2, "chain holds")
@@ -314,3 +328,144 @@ func TestCommandFactory(t *testing.T) {
 	shellExec = cmd.(CmdExecShell)
 	assert(t, shellExec.Script == "")
 }
+
+func TestCommandDefinitionTyped(t *testing.T) {
+	t.Run("RoundTrip", func(t *testing.T) {
+		cases := map[string]Command{
+			"subprocess.exec": CmdExec{Binary: "make", Args: []string{"test"}, Env: map[string]string{"a": "b"}},
+			"shell.exec":      CmdExecShell{Script: "echo hi", ContinueOnError: true},
+			"s3.put":          CmdS3Put{AWSKey: "foo", AWSSecret: "bar", LocalFile: "baz", Bucket: "b", RemoteFile: "r", ContentType: "text/plain", BuildVariants: []string{"ubuntu"}},
+			"archive.zip":     CmdArchiveCreate{Format: ZIP, Target: "out.zip", SourceDir: "dist", Include: []string{"*"}},
+			"archive.tarball": CmdArchiveExtract{Format: TARBALL, ArchivePath: "in.tgz", TargetDirectory: "out"},
+			"host.create":     CmdHostCreate{Distro: "ubuntu", EBSDevices: []HostCreateEBSDevice{{DeviceName: "xvdb", SizeGiB: 10}}},
+		}
+
+		for name, cmd := range cases {
+			t.Run(name, func(t *testing.T) {
+				typed, err := cmd.Resolve().Typed()
+				require(t, err == nil, errString(err))
+				assert(t, reflect.DeepEqual(typed, cmd), "round trip produces the same command")
+			})
+		}
+	})
+	t.Run("DecodedDefinition", func(t *testing.T) {
+		def := &CommandDefinition{}
+		def.Command("shell.exec").Param("script", "make test").Param("env", map[string]interface{}{"GOROOT": "/opt/go"})
+
+		typed, err := def.Typed()
+		require(t, err == nil, errString(err))
+		shell, ok := typed.(CmdExecShell)
+		require(t, ok, "produces the concrete type")
+		assert(t, shell.Script == "make test")
+		assert(t, shell.Env["GOROOT"] == "/opt/go")
+	})
+	t.Run("NoParams", func(t *testing.T) {
+		typed, err := (&CommandDefinition{CommandName: "s3.push"}).Typed()
+		require(t, err == nil, errString(err))
+		assert(t, reflect.DeepEqual(typed, CmdS3Push{}))
+	})
+	t.Run("FunctionCall", func(t *testing.T) {
+		typed, err := (&CommandDefinition{FunctionName: "setup"}).Typed()
+		assert(t, err != nil)
+		assert(t, typed == nil)
+	})
+	t.Run("UnknownCommand", func(t *testing.T) {
+		typed, err := (&CommandDefinition{CommandName: "nothere"}).Typed()
+		assert(t, err != nil)
+		assert(t, typed == nil)
+	})
+	t.Run("MalformedParams", func(t *testing.T) {
+		def := &CommandDefinition{CommandName: "subprocess.exec"}
+		def.Param("args", "not-a-list")
+		typed, err := def.Typed()
+		assert(t, err != nil)
+		assert(t, typed == nil)
+	})
+	t.Run("InvalidCommand", func(t *testing.T) {
+		def := &CommandDefinition{CommandName: "s3.put"}
+		def.Param("local_file", "foo")
+		typed, err := def.Typed()
+		assert(t, err != nil)
+		assert(t, typed == nil)
+	})
+}
+
+type customCmd struct {
+	Target string `json:"target" yaml:"target"`
+}
+
+func (c customCmd) Name() string { return "custom.build" }
+func (c customCmd) Validate() error {
+	if c.Target == "" {
+		return errors.New("must specify a target")
+	}
+	return nil
+}
+func (c customCmd) Resolve() *CommandDefinition {
+	return &CommandDefinition{
+		CommandName: c.Name(),
+		Params:      exportCmd(c),
+	}
+}
+
+type namelessCmd struct{ customCmd }
+
+func (c namelessCmd) Name() string { return "" }
+
+func TestRegisterCommand(t *testing.T) {
+	unregister := func(name string) {
+		registeredCommands.mu.Lock()
+		defer registeredCommands.mu.Unlock()
+		delete(registeredCommands.commands, name)
+	}
+
+	t.Run("NewCommand", func(t *testing.T) {
+		defer unregister("custom.build")
+
+		require(t, GetCommand("custom.build") == nil, "not registered by default")
+		err := RegisterCommand(func() Command { return customCmd{} })
+		require(t, err == nil, errString(err))
+		assert(t, reflect.DeepEqual(GetCommand("custom.build"), customCmd{}))
+
+		typed, err := customCmd{Target: "all"}.Resolve().Typed()
+		require(t, err == nil, errString(err))
+		assert(t, reflect.DeepEqual(typed, customCmd{Target: "all"}), "round trips through the registry")
+
+		_, err = (&CommandDefinition{CommandName: "custom.build"}).Typed()
+		assert(t, err != nil, "validates decoded command")
+	})
+	t.Run("Duplicate", func(t *testing.T) {
+		defer unregister("custom.build")
+
+		require(t, RegisterCommand(func() Command { return customCmd{} }) == nil)
+		assert(t, RegisterCommand(func() Command { return customCmd{Target: "x"} }) != nil, "duplicate names are rejected")
+		assert(t, reflect.DeepEqual(GetCommand("custom.build"), customCmd{}), "original is retained")
+		assert(t, RegisterCommand(shellExecFactory) != nil, "built in commands cannot be replaced")
+	})
+	t.Run("Override", func(t *testing.T) {
+		defer unregister("custom.build")
+
+		require(t, OverrideCommand(func() Command { return customCmd{} }) == nil, "override of new command")
+		require(t, OverrideCommand(func() Command { return customCmd{Target: "x"} }) == nil, "override of existing command")
+		assert(t, reflect.DeepEqual(GetCommand("custom.build"), customCmd{Target: "x"}))
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		assert(t, RegisterCommand(nil) != nil, "nil factory")
+		assert(t, RegisterCommand(func() Command { return nil }) != nil, "nil command")
+		assert(t, RegisterCommand(func() Command { return namelessCmd{} }) != nil, "nameless command")
+		assert(t, OverrideCommand(nil) != nil, "nil factory")
+	})
+	t.Run("RegisteredCommands", func(t *testing.T) {
+		defer unregister("custom.build")
+
+		names := RegisteredCommands()
+		assert(t, len(names) == len(registeredCommands.commands))
+		assert(t, sort.StringsAreSorted(names))
+
+		require(t, RegisterCommand(func() Command { return customCmd{} }) == nil)
+		withCustom := RegisteredCommands()
+		assert(t, len(withCustom) == len(names)+1)
+		idx := sort.SearchStrings(withCustom, "custom.build")
+		assert(t, idx < len(withCustom) && withCustom[idx] == "custom.build")
+	})
+}
@@ -3,10 +3,26 @@ package shrub
 // Configuration is the top-level representation of the components of
 // an evergreen project configuration.
 type Configuration struct {
+	CommandType         string          `json:"command_type,omitempty" yaml:"command_type,omitempty"`
+	Stepback            *bool           `json:"stepback,omitempty" yaml:"stepback,omitempty"`
+	IgnoredFiles        []string        `json:"ignore,omitempty" yaml:"ignore,omitempty"`
+	ExecTimeoutSecs     int             `json:"exec_timeout_secs,omitempty" yaml:"exec_timeout_secs,omitempty"`
+	CallbackTimeoutSecs int             `json:"callback_timeout_secs,omitempty" yaml:"callback_timeout_secs,omitempty"`
+	PreTimeoutSecs      int             `json:"pre_timeout_secs,omitempty" yaml:"pre_timeout_secs,omitempty"`
+	PostTimeoutSecs     int             `json:"post_timeout_secs,omitempty" yaml:"post_timeout_secs,omitempty"`
+	PreErrorFailsTask   bool            `json:"pre_error_fails_task,omitempty" yaml:"pre_error_fails_task,omitempty"`
+	PostErrorFailsTask  bool            `json:"post_error_fails_task,omitempty" yaml:"post_error_fails_task,omitempty"`
+	PreCommands         CommandSequence `json:"pre,omitempty" yaml:"pre,omitempty"`
+	PostCommands        CommandSequence `json:"post,omitempty" yaml:"post,omitempty"`
+	TimeoutCommands     CommandSequence `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Modules             []*Module       `json:"modules,omitempty" yaml:"modules,omitempty"`
+
 	Functions map[string]*CommandSequence `json:"functions,omitempty" yaml:"functions,omitempty"`
 	Tasks     []*Task                     `json:"tasks,omitempty" yaml:"tasks,omitempty"`
 	Groups    []*TaskGroup                `json:"task_groups,omitempty" yaml:"task_groups,omitempty"`
 	Variants  []*Variant                  `json:"buildvariants,omitempty" yaml:"buildvariants,omitempty"`
+
+	collector *buildCollector
 }
 
 // Task returns a task of the specified name. If the task already
@@ -15,12 +31,18 @@ type Configuration struct {
 func (c *Configuration) Task(name string) *Task {
 	for _, t := range c.Tasks {
 		if t.Name == name {
+			// Keep any collector that the task already reports to,
+			// such as a Builder's.
+			if t.collector == nil {
+				t.collector = c.collector
+			}
 			return t
 		}
 	}
 
 	t := new(Task)
 	t.Name = name
+	t.collector = c.collector
 	c.Tasks = append(c.Tasks, t)
 	return t
 }
@@ -32,11 +54,14 @@ func (c *Configuration) Task(name string) *Task {
 func (c *Configuration) TaskGroup(name string) *TaskGroup {
 	for _, g := range c.Groups {
 		if g.GroupName == name {
+			if g.collector == nil {
+				g.collector = c.collector
+			}
 			return g
 		}
 	}
 
-	g := new(TaskGroup)
+	g := &TaskGroup{collector: c.collector}
 	c.Groups = append(c.Groups, g)
 	return g.Name(name)
 }
@@ -73,3 +98,77 @@ func (c *Configuration) Variant(id string) *Variant {
 	c.Variants = append(c.Variants, v)
 	return v.Name(id)
 }
+
+// Module returns the module of the specified name. If the module
+// already exists, then it returns the existing module of that name, and
+// otherwise returns a new module of the specified name.
+func (c *Configuration) Module(name string) *Module {
+	for _, m := range c.Modules {
+		if m != nil && m.ModuleName == name {
+			return m
+		}
+	}
+
+	m := new(Module)
+	c.Modules = append(c.Modules, m)
+	return m.Name(name)
+}
+
+// Pre returns the sequence of commands that run before every task in
+// the project, for use in adding commands to it.
+func (c *Configuration) Pre() *CommandSequence { return &c.PreCommands }
+
+// Post returns the sequence of commands that run after every task in
+// the project, for use in adding commands to it.
+func (c *Configuration) Post() *CommandSequence { return &c.PostCommands }
+
+// Timeout returns the sequence of commands that run when a task in the
+// project times out, for use in adding commands to it.
+func (c *Configuration) Timeout() *CommandSequence { return &c.TimeoutCommands }
+
+func (c *Configuration) SetCommandType(cmdType string) *Configuration {
+	c.CommandType = cmdType
+	return c
+}
+
+func (c *Configuration) SetStepback(val bool) *Configuration {
+	c.Stepback = &val
+	return c
+}
+
+// Ignore adds file patterns which, when they are the only files
+// changed by a commit, do not cause Evergreen to create a version.
+func (c *Configuration) Ignore(globs ...string) *Configuration {
+	c.IgnoredFiles = append(c.IgnoredFiles, globs...)
+	return c
+}
+
+func (c *Configuration) SetExecTimeoutSecs(timeoutSecs int) *Configuration {
+	c.ExecTimeoutSecs = timeoutSecs
+	return c
+}
+
+func (c *Configuration) SetCallbackTimeoutSecs(timeoutSecs int) *Configuration {
+	c.CallbackTimeoutSecs = timeoutSecs
+	return c
+}
+
+func (c *Configuration) SetPreTimeoutSecs(timeoutSecs int) *Configuration {
+	c.PreTimeoutSecs = timeoutSecs
+	return c
+}
+
+func (c *Configuration) SetPostTimeoutSecs(timeoutSecs int) *Configuration {
+	c.PostTimeoutSecs = timeoutSecs
+	return c
+}
+
+func (c *Configuration) SetPreErrorFailsTask(val bool) *Configuration {
+	c.PreErrorFailsTask = val
+	return c
+}
+
+func (c *Configuration) SetPostErrorFailsTask(val bool) *Configuration {
+	c.PostErrorFailsTask = val
+	return c
+}
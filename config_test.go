@@ -173,6 +173,34 @@ func TestConfigTopLevelModifiers(t *testing.T) {
 				assert(t, different != task)
 			}
 		},
+		"AddOneModule": func(t *testing.T, conf *Configuration) {
+			m := conf.Module("tools").Repo("git@github.com:evergreen-ci/tools.git").Branch("main").Prefix("src/modules")
+			assert(t, conf.Module("tools") == m)
+			assert(t, conf.Module("docs") != m)
+			require(t, len(conf.Modules) == 2)
+			assert(t, m.ModuleName == "tools" && m.BranchName == "main" && m.PathPrefix == "src/modules")
+		},
+		"ProjectCommands": func(t *testing.T, conf *Configuration) {
+			conf.Pre().Add(CmdGetProject{Directory: "src"})
+			conf.Post().Append(&CommandDefinition{FunctionName: "parse-results"})
+			conf.Timeout().Add(CmdExec{Binary: "true"})
+			assert(t, conf.Pre() == conf.Pre())
+			assert(t, len(conf.PreCommands) == 1)
+			assert(t, len(conf.PostCommands) == 1)
+			assert(t, len(conf.TimeoutCommands) == 1)
+		},
+		"ProjectSettings": func(t *testing.T, conf *Configuration) {
+			c2 := conf.SetCommandType("setup").SetStepback(false).Ignore("*.md").Ignore("*.rst").
+				SetExecTimeoutSecs(60).SetCallbackTimeoutSecs(30).SetPreTimeoutSecs(10).SetPostTimeoutSecs(20).
+				SetPreErrorFailsTask(true).SetPostErrorFailsTask(true)
+			assert(t, conf == c2, "chainable")
+			assert(t, conf.CommandType == "setup")
+			assert(t, conf.Stepback != nil && !*conf.Stepback)
+			assert(t, len(conf.IgnoredFiles) == 2)
+			assert(t, conf.ExecTimeoutSecs == 60 && conf.CallbackTimeoutSecs == 30)
+			assert(t, conf.PreTimeoutSecs == 10 && conf.PostTimeoutSecs == 20)
+			assert(t, conf.PreErrorFailsTask && conf.PostErrorFailsTask)
+		},
 	}
 
 	for name, test := range cases {
@@ -0,0 +1,364 @@
+package shrub
+
+import (
+	"container/heap"
+	"fmt"
+	"strings"
+)
+
+// TaskInstance identifies a task as it runs in a particular build
+// variant.
+type TaskInstance struct {
+	Variant string
+	Task    string
+}
+
+func (ti TaskInstance) String() string { return ti.Variant + "/" + ti.Task }
+
+// UnresolvedDependency is a dependency of a task instance that does not
+// match any task instance in the configuration.
+type UnresolvedDependency struct {
+	From       TaskInstance
+	Dependency TaskDependency
+}
+
+func (ud UnresolvedDependency) String() string {
+	variant := ud.Dependency.Variant
+	if variant == "" {
+		variant = ud.From.Variant
+	}
+	return fmt.Sprintf("%s depends on %s/%s, which does not exist", ud.From, variant, ud.Dependency.Name)
+}
+
+// DependencyGraph describes the dependencies between every task
+// instance (a task in a build variant) in a configuration.
+//
+// The dependencies of each instance are taken from the first of the
+// following that is set: the depends_on of the variant's task spec, the
+// depends_on of the task definition, and the depends_on of the variant.
+// Task specs naming a task group produce one instance per task in the
+// group, and task specs that are selectors produce one instance per
+// selected task. A dependency without a variant refers to the same
+// variant, a dependency on a task group refers to every task in the
+// group, and "*" matches every variant or every task (other than the
+// dependent task itself).
+type DependencyGraph struct {
+	instances  []TaskInstance
+	index      map[TaskInstance]int
+	edges      map[TaskInstance][]TaskInstance
+	unresolved []UnresolvedDependency
+	// groups maps the name of each task group to its tasks.
+	groups map[string][]string
+}
+
+// NewDependencyGraph builds the dependency graph for the configuration.
+func NewDependencyGraph(c *Configuration) *DependencyGraph {
+	g := &DependencyGraph{
+		index:  map[TaskInstance]int{},
+		edges:  map[TaskInstance][]TaskInstance{},
+		groups: map[string][]string{},
+	}
+	for _, tg := range c.Groups {
+		if tg != nil {
+			g.groups[tg.GroupName] = append(g.groups[tg.GroupName], tg.Tasks...)
+		}
+	}
+
+	deps := map[TaskInstance][]TaskDependency{}
+	add := func(ti TaskInstance, spec TaskSpec, v *Variant) {
+		if _, ok := g.index[ti]; ok {
+			return
+		}
+		g.index[ti] = len(g.instances)
+		g.instances = append(g.instances, ti)
+
+		switch task := c.findTask(ti.Task); {
+		case len(spec.DependsOn) > 0:
+			deps[ti] = spec.DependsOn
+		case task != nil && len(task.Dependencies) > 0:
+			deps[ti] = task.Dependencies
+		default:
+			deps[ti] = v.DependsOn
+		}
+	}
+
+	for _, v := range c.Variants {
+		if v == nil {
+			continue
+		}
+		for _, spec := range v.TaskSpecs {
+			for _, name := range c.taskSpecTasks(spec) {
+				add(TaskInstance{Variant: v.BuildName, Task: name}, spec, v)
+			}
+		}
+	}
+
+	for _, ti := range g.instances {
+		for _, dep := range deps[ti] {
+			targets := g.resolve(ti, dep)
+			if len(targets) == 0 {
+				g.unresolved = append(g.unresolved, UnresolvedDependency{From: ti, Dependency: dep})
+				continue
+			}
+			for _, target := range targets {
+				if !containsInstance(g.edges[ti], target) {
+					g.edges[ti] = append(g.edges[ti], target)
+				}
+			}
+		}
+	}
+
+	return g
+}
+
+// taskSpecTasks returns the names of the tasks that a variant's task
+// spec adds to the variant.
+func (c *Configuration) taskSpecTasks(spec TaskSpec) []string {
+	switch {
+	case isTaskSelector(spec.Name):
+		return c.selectorTasks(spec.Name)
+	case spec.TaskGroup != nil:
+		return spec.TaskGroup.Tasks
+	}
+
+	if g := c.findGroup(spec.Name); g != nil {
+		return g.Tasks
+	}
+
+	return []string{spec.Name}
+}
+
+func (g *DependencyGraph) resolve(from TaskInstance, dep TaskDependency) []TaskInstance {
+	names := append([]string{dep.Name}, g.groups[dep.Name]...)
+	out := []TaskInstance{}
+	for _, ti := range g.instances {
+		switch {
+		case dep.Variant == "" && ti.Variant != from.Variant:
+		case dep.Variant != "" && dep.Variant != "*" && ti.Variant != dep.Variant:
+		case ti == from && dep.Name != ti.Task:
+		case dep.Name != "*" && !containsString(names, ti.Task):
+		default:
+			out = append(out, ti)
+		}
+	}
+	return out
+}
+
+// Instances returns every task instance in the graph, in the order in
+// which the variants and their tasks are defined.
+func (g *DependencyGraph) Instances() []TaskInstance {
+	return append([]TaskInstance{}, g.instances...)
+}
+
+// Dependencies returns the task instances that the given instance
+// directly depends on.
+func (g *DependencyGraph) Dependencies(ti TaskInstance) []TaskInstance {
+	return append([]TaskInstance{}, g.edges[ti]...)
+}
+
+// Unresolved returns the dependencies that do not match any task
+// instance in the configuration.
+func (g *DependencyGraph) Unresolved() []UnresolvedDependency {
+	return append([]UnresolvedDependency{}, g.unresolved...)
+}
+
+// Cycles returns the dependency cycles in the graph. Each cycle is
+// reported as the full path of instances, beginning and ending with
+// the same instance.
+func (g *DependencyGraph) Cycles() [][]TaskInstance {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := map[TaskInstance]int{}
+	stack := []TaskInstance{}
+	seen := map[string]bool{}
+	out := [][]TaskInstance{}
+
+	var visit func(TaskInstance)
+	visit = func(ti TaskInstance) {
+		state[ti] = visiting
+		stack = append(stack, ti)
+
+		for _, dep := range g.edges[ti] {
+			switch state[dep] {
+			case unvisited:
+				visit(dep)
+			case visiting:
+				start := len(stack) - 1
+				for stack[start] != dep {
+					start--
+				}
+				cycle := append(append([]TaskInstance{}, stack[start:]...), dep)
+				if key := cycleKey(cycle); !seen[key] {
+					seen[key] = true
+					out = append(out, cycle)
+				}
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[ti] = visited
+	}
+
+	for _, ti := range g.instances {
+		if state[ti] == unvisited {
+			visit(ti)
+		}
+	}
+
+	return out
+}
+
+// cycleKey identifies a cycle independently of the instance at which
+// it was entered.
+func cycleKey(cycle []TaskInstance) string {
+	nodes := cycle[:len(cycle)-1]
+	first := 0
+	for idx := range nodes {
+		if nodes[idx].String() < nodes[first].String() {
+			first = idx
+		}
+	}
+
+	parts := make([]string, 0, len(nodes))
+	for idx := range nodes {
+		parts = append(parts, nodes[(first+idx)%len(nodes)].String())
+	}
+	return strings.Join(parts, " -> ")
+}
+
+func formatCycle(cycle []TaskInstance) string {
+	parts := make([]string, 0, len(cycle))
+	for _, ti := range cycle {
+		parts = append(parts, ti.String())
+	}
+	return strings.Join(parts, " -> ")
+}
+
+// TopologicalOrder returns every task instance ordered so that each
+// instance appears after all of its dependencies. Instances that are
+// otherwise unordered retain their definition order. It returns an
+// error if the graph contains a cycle.
+func (g *DependencyGraph) TopologicalOrder() ([]TaskInstance, error) {
+	if cycles := g.Cycles(); len(cycles) > 0 {
+		return nil, fmt.Errorf("dependency cycle: %s", formatCycle(cycles[0]))
+	}
+
+	remaining := make([]int, len(g.instances))
+	dependents := make([][]int, len(g.instances))
+	ready := &intHeap{}
+	for idx, ti := range g.instances {
+		remaining[idx] = len(g.edges[ti])
+		for _, dep := range g.edges[ti] {
+			dependents[g.index[dep]] = append(dependents[g.index[dep]], idx)
+		}
+		if remaining[idx] == 0 {
+			heap.Push(ready, idx)
+		}
+	}
+
+	// Always take the earliest defined instance whose dependencies
+	// have all been satisfied.
+	out := make([]TaskInstance, 0, len(g.instances))
+	for ready.Len() > 0 {
+		idx := heap.Pop(ready).(int)
+		out = append(out, g.instances[idx])
+		for _, dependent := range dependents[idx] {
+			remaining[dependent]--
+			if remaining[dependent] == 0 {
+				heap.Push(ready, dependent)
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// Depths returns the critical-path depth of every task instance: the
+// number of instances in the longest chain of dependencies that ends
+// with (and includes) that instance. Instances without dependencies
+// have a depth of one. It returns an error if the graph contains a
+// cycle.
+func (g *DependencyGraph) Depths() (map[TaskInstance]int, error) {
+	order, err := g.TopologicalOrder()
+	if err != nil {
+		return nil, err
+	}
+
+	depths := make(map[TaskInstance]int, len(order))
+	for _, ti := range order {
+		depth := 1
+		for _, dep := range g.edges[ti] {
+			if depths[dep]+1 > depth {
+				depth = depths[dep] + 1
+			}
+		}
+		depths[ti] = depth
+	}
+
+	return depths, nil
+}
+
+// CriticalPath returns the longest chain of dependent task instances
+// in the graph, in the order in which they must run. It returns an
+// error if the graph contains a cycle.
+func (g *DependencyGraph) CriticalPath() ([]TaskInstance, error) {
+	depths, err := g.Depths()
+	if err != nil {
+		return nil, err
+	}
+
+	var end TaskInstance
+	longest := 0
+	for _, ti := range g.instances {
+		if depths[ti] > longest {
+			end, longest = ti, depths[ti]
+		}
+	}
+	if longest == 0 {
+		return []TaskInstance{}, nil
+	}
+
+	path := []TaskInstance{end}
+	for current := end; depths[current] > 1; {
+		for _, dep := range g.edges[current] {
+			if depths[dep] == depths[current]-1 {
+				current = dep
+				break
+			}
+		}
+		path = append(path, current)
+	}
+
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+
+	return path, nil
+}
+
+func containsInstance(list []TaskInstance, ti TaskInstance) bool {
+	for _, item := range list {
+		if item == ti {
+			return true
+		}
+	}
+	return false
+}
+
+type intHeap []int
+
+func (h intHeap) Len() int            { return len(h) }
+func (h intHeap) Less(i, j int) bool  { return h[i] < h[j] }
+func (h intHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *intHeap) Push(x interface{}) { *h = append(*h, x.(int)) }
+func (h *intHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
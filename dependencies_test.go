@@ -0,0 +1,173 @@
+package shrub
+
+import (
+	"strings"
+	"testing"
+)
+
+func instance(variant, task string) TaskInstance { return TaskInstance{Variant: variant, Task: task} }
+
+func TestDependencyGraph(t *testing.T) {
+	t.Run("Empty", func(t *testing.T) {
+		g := NewDependencyGraph(&Configuration{})
+		assert(t, len(g.Instances()) == 0)
+		assert(t, len(g.Cycles()) == 0)
+		order, err := g.TopologicalOrder()
+		assert(t, err == nil && len(order) == 0)
+		path, err := g.CriticalPath()
+		assert(t, err == nil && len(path) == 0)
+	})
+	t.Run("Precedence", func(t *testing.T) {
+		conf := &Configuration{}
+		conf.Task("compile")
+		conf.Task("lint")
+		conf.Task("test").Dependency(TaskDependency{Name: "compile"})
+		conf.Task("package")
+		conf.Variant("ubuntu").SetDependsOn(TaskDependency{Name: "lint"}).
+			AddTasks("compile", "lint", "test", "package").
+			TaskSpec(TaskSpec{Name: "release", DependsOn: []TaskDependency{{Name: "package"}}})
+		conf.Task("release").Dependency(TaskDependency{Name: "test"})
+
+		g := NewDependencyGraph(conf)
+		assert(t, len(g.Instances()) == 5)
+
+		deps := g.Dependencies(instance("ubuntu", "test"))
+		require(t, len(deps) == 1)
+		assert(t, deps[0] == instance("ubuntu", "compile"), "task dependencies beat variant dependencies")
+
+		deps = g.Dependencies(instance("ubuntu", "package"))
+		require(t, len(deps) == 1)
+		assert(t, deps[0] == instance("ubuntu", "lint"), "variant dependencies are the default")
+
+		deps = g.Dependencies(instance("ubuntu", "release"))
+		require(t, len(deps) == 1)
+		assert(t, deps[0] == instance("ubuntu", "package"), "task spec dependencies beat task dependencies")
+
+		deps = g.Dependencies(instance("ubuntu", "lint"))
+		require(t, len(deps) == 1, "variant dependencies include self")
+		assert(t, len(g.Cycles()) == 1, "depending on yourself is a cycle")
+	})
+	t.Run("CrossVariantAndWildcards", func(t *testing.T) {
+		conf := &Configuration{}
+		conf.Task("compile")
+		conf.Task("test").Dependency(TaskDependency{Name: "compile", Variant: "*"})
+		conf.Task("report").Dependency(TaskDependency{Name: "*"})
+		conf.Task("publish").Dependency(TaskDependency{Name: "*", Variant: "*"})
+		conf.Variant("ubuntu").AddTasks("compile", "test", "report")
+		conf.Variant("windows").AddTasks("compile", "test")
+		conf.Variant("release").AddTasks("publish")
+
+		g := NewDependencyGraph(conf)
+		assert(t, len(g.Dependencies(instance("ubuntu", "test"))) == 2)
+		assert(t, len(g.Dependencies(instance("ubuntu", "report"))) == 2, "all other tasks in the variant")
+		assert(t, len(g.Dependencies(instance("release", "publish"))) == 5, "all other tasks")
+		assert(t, len(g.Unresolved()) == 0)
+		assert(t, len(g.Cycles()) == 0)
+	})
+	t.Run("TaskGroups", func(t *testing.T) {
+		conf := &Configuration{}
+		conf.Task("setup")
+		conf.Task("one").Dependency(TaskDependency{Name: "setup"})
+		conf.Task("two").Dependency(TaskDependency{Name: "one"})
+		conf.TaskGroup("group").Task("one", "two")
+		conf.Variant("ubuntu").AddTasks("setup", "group")
+
+		g := NewDependencyGraph(conf)
+		assert(t, len(g.Instances()) == 3, "groups are expanded")
+		path, err := g.CriticalPath()
+		require(t, err == nil, errString(err))
+		require(t, len(path) == 3)
+		assert(t, path[0] == instance("ubuntu", "setup"))
+		assert(t, path[2] == instance("ubuntu", "two"))
+	})
+	t.Run("DependencyOnTaskGroup", func(t *testing.T) {
+		conf := &Configuration{}
+		conf.Task("one")
+		conf.Task("two").Dependency(TaskDependency{Name: "group"})
+		conf.Task("report").Dependency(TaskDependency{Name: "group"})
+		conf.TaskGroup("group").Task("one", "two")
+		conf.Variant("ubuntu").AddTasks("group", "report")
+
+		require(t, conf.Validate() == nil, errString(conf.Validate()))
+		g := NewDependencyGraph(conf)
+		assert(t, len(g.Unresolved()) == 0, "task groups are expanded to their tasks")
+		deps := g.Dependencies(instance("ubuntu", "report"))
+		require(t, len(deps) == 2)
+		assert(t, deps[0] == instance("ubuntu", "one") && deps[1] == instance("ubuntu", "two"))
+		assert(t, len(g.Dependencies(instance("ubuntu", "two"))) == 1, "tasks in the group do not depend on themselves")
+		assert(t, len(g.Cycles()) == 0)
+	})
+	t.Run("Unresolved", func(t *testing.T) {
+		conf := &Configuration{}
+		conf.Task("test").Dependency(TaskDependency{Name: "compile"}, TaskDependency{Name: "lint", Variant: "windows"})
+		conf.Task("compile")
+		conf.Variant("ubuntu").AddTasks("test")
+
+		unresolved := NewDependencyGraph(conf).Unresolved()
+		require(t, len(unresolved) == 2, "compile is defined but not in the variant")
+		assert(t, unresolved[0].From == instance("ubuntu", "test"))
+		assert(t, unresolved[0].Dependency.Name == "compile")
+		assert(t, strings.Contains(unresolved[1].String(), "windows/lint"), unresolved[1].String())
+	})
+	t.Run("Cycles", func(t *testing.T) {
+		conf := &Configuration{}
+		conf.Task("a").Dependency(TaskDependency{Name: "b"})
+		conf.Task("b").Dependency(TaskDependency{Name: "c"})
+		conf.Task("c").Dependency(TaskDependency{Name: "a"})
+		conf.Task("d").Dependency(TaskDependency{Name: "a"})
+		conf.Variant("ubuntu").AddTasks("d", "a", "b", "c")
+
+		g := NewDependencyGraph(conf)
+		cycles := g.Cycles()
+		require(t, len(cycles) == 1, "cycle reported once")
+		require(t, len(cycles[0]) == 4, "full path")
+		assert(t, cycles[0][0] == cycles[0][3], "path is closed")
+		assert(t, formatCycle(cycles[0]) == "ubuntu/a -> ubuntu/b -> ubuntu/c -> ubuntu/a", formatCycle(cycles[0]))
+
+		order, err := g.TopologicalOrder()
+		assert(t, err != nil)
+		assert(t, order == nil)
+		_, err = g.Depths()
+		assert(t, err != nil)
+		_, err = g.CriticalPath()
+		assert(t, err != nil)
+
+		err = conf.Validate()
+		require(t, err != nil)
+		assert(t, strings.Contains(err.Error(), "dependency cycle ubuntu/a -> ubuntu/b"), err.Error())
+	})
+	t.Run("TopologicalOrder", func(t *testing.T) {
+		conf := &Configuration{}
+		conf.Task("lint")
+		conf.Task("test").Dependency(TaskDependency{Name: "compile"})
+		conf.Task("compile")
+		conf.Task("package").Dependency(TaskDependency{Name: "test"}, TaskDependency{Name: "compile", Variant: "windows"})
+		conf.Variant("ubuntu").AddTasks("package", "test", "lint", "compile")
+		conf.Variant("windows").AddTasks("compile")
+
+		g := NewDependencyGraph(conf)
+		order, err := g.TopologicalOrder()
+		require(t, err == nil, errString(err))
+		require(t, len(order) == 5)
+		pos := map[TaskInstance]int{}
+		for idx, ti := range order {
+			pos[ti] = idx
+		}
+		assert(t, order[0] == instance("ubuntu", "lint"), "definition order breaks ties")
+		assert(t, pos[instance("ubuntu", "compile")] < pos[instance("ubuntu", "test")])
+		assert(t, pos[instance("ubuntu", "test")] < pos[instance("ubuntu", "package")])
+		assert(t, pos[instance("windows", "compile")] < pos[instance("ubuntu", "package")])
+
+		depths, err := g.Depths()
+		require(t, err == nil, errString(err))
+		assert(t, depths[instance("ubuntu", "lint")] == 1)
+		assert(t, depths[instance("ubuntu", "package")] == 3)
+
+		path, err := g.CriticalPath()
+		require(t, err == nil, errString(err))
+		require(t, len(path) == 3)
+		assert(t, path[0] == instance("ubuntu", "compile"))
+		assert(t, path[1] == instance("ubuntu", "test"))
+		assert(t, path[2] == instance("ubuntu", "package"))
+	})
+}
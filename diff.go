@@ -0,0 +1,292 @@
+package shrub
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// ChangeType describes how an element differs between two
+// configurations.
+type ChangeType string
+
+const (
+	ChangeAdded    ChangeType = "added"
+	ChangeRemoved  ChangeType = "removed"
+	ChangeModified ChangeType = "modified"
+)
+
+// Change describes a single difference between two configurations.
+type Change struct {
+	Type ChangeType `json:"type"`
+	// Kind is the kind of element that changed: "function", "module",
+	// "task", "task_group", "variant", or "project" for any other
+	// top-level setting.
+	Kind string `json:"kind"`
+	// Name is the name of the function, module, task, task group or
+	// variant, or the name of the top-level setting.
+	Name string `json:"name"`
+	// Path identifies the changed field within the element, using the
+	// configuration's field names, e.g. "tasks[compile].priority" or
+	// "[1].params.script". Lists of named elements are indexed by name
+	// and other lists by position. Path is empty when the whole element
+	// was added or removed.
+	Path string `json:"path,omitempty"`
+	// Old and New hold the JSON representation of the previous and
+	// current values.
+	Old interface{} `json:"old,omitempty"`
+	New interface{} `json:"new,omitempty"`
+}
+
+// String returns a human-readable description of the change.
+func (c Change) String() string {
+	if c.Path == "" {
+		return fmt.Sprintf("%s %s %s", c.Type, c.Kind, c.Name)
+	}
+
+	prefix := fmt.Sprintf("%s %s: %s %s", c.Kind, c.Name, c.Type, c.Path)
+	switch c.Type {
+	case ChangeAdded:
+		return fmt.Sprintf("%s (%s)", prefix, diffValue(c.New))
+	case ChangeRemoved:
+		return fmt.Sprintf("%s (%s)", prefix, diffValue(c.Old))
+	default:
+		return fmt.Sprintf("%s: %s -> %s", prefix, diffValue(c.Old), diffValue(c.New))
+	}
+}
+
+func diffValue(v interface{}) string {
+	out, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(out)
+}
+
+// Diff reports the differences between two configurations. Functions,
+// modules, tasks, task groups and variants are matched by name, and are
+// reported either as added, removed, or with a change for every field
+// that was added, removed or modified within them. Changes are ordered
+// by kind and then by the order in which the elements are defined. A
+// nil configuration is treated as empty.
+//
+// Diff panics if either configuration cannot be represented as JSON.
+func Diff(a, b *Configuration) []Change {
+	at, bt := configurationTree(a), configurationTree(b)
+
+	d := &differ{out: []Change{}}
+
+	afn, _ := at["functions"].(map[string]interface{})
+	bfn, _ := bt["functions"].(map[string]interface{})
+	for _, name := range unionKeys(afn, bfn) {
+		d.entity("function", name, afn[name], bfn[name])
+	}
+
+	for _, section := range []struct{ key, kind string }{
+		{key: "modules", kind: "module"},
+		{key: "tasks", kind: "task"},
+		{key: "task_groups", kind: "task_group"},
+		{key: "buildvariants", kind: "variant"},
+	} {
+		al, _ := at[section.key].([]interface{})
+		bl, _ := bt[section.key].([]interface{})
+		aIdx, bIdx := indexByName(al), indexByName(bl)
+		for _, name := range unionNames(al, bl) {
+			d.entity(section.kind, name, aIdx[name], bIdx[name])
+		}
+	}
+
+	for _, key := range []string{"functions", "modules", "tasks", "task_groups", "buildvariants"} {
+		delete(at, key)
+		delete(bt, key)
+	}
+	for _, key := range unionKeys(at, bt) {
+		d.entity("project", key, at[key], bt[key])
+	}
+
+	return d.out
+}
+
+// WriteChangesText writes each change on its own line in a
+// human-readable form.
+func WriteChangesText(w io.Writer, changes []Change) error {
+	for _, c := range changes {
+		if _, err := fmt.Fprintln(w, c.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteChangesJSON writes the changes as an indented JSON array.
+func WriteChangesJSON(w io.Writer, changes []Change) error {
+	if changes == nil {
+		changes = []Change{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	return enc.Encode(changes)
+}
+
+func configurationTree(c *Configuration) map[string]interface{} {
+	out := map[string]interface{}{}
+	if c == nil {
+		return out
+	}
+
+	data, err := json.Marshal(c)
+	if err == nil {
+		if err = json.Unmarshal(data, &out); err == nil {
+			return out
+		}
+	}
+
+	panic(err)
+}
+
+type differ struct {
+	out []Change
+}
+
+func (d *differ) entity(kind, name string, a, b interface{}) {
+	switch {
+	case a == nil && b == nil:
+	case a == nil:
+		d.out = append(d.out, Change{Type: ChangeAdded, Kind: kind, Name: name, New: b})
+	case b == nil:
+		d.out = append(d.out, Change{Type: ChangeRemoved, Kind: kind, Name: name, Old: a})
+	default:
+		d.value(kind, name, "", a, b)
+	}
+}
+
+func (d *differ) value(kind, name, path string, a, b interface{}) {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		if bv, ok := b.(map[string]interface{}); ok {
+			for _, key := range unionKeys(av, bv) {
+				d.field(kind, name, joinPath(path, key), av, bv, key)
+			}
+			return
+		}
+	case []interface{}:
+		if bv, ok := b.([]interface{}); ok {
+			d.list(kind, name, path, av, bv)
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		d.out = append(d.out, Change{Type: ChangeModified, Kind: kind, Name: name, Path: path, Old: a, New: b})
+	}
+}
+
+func (d *differ) field(kind, name, path string, a, b map[string]interface{}, key string) {
+	av, aok := a[key]
+	bv, bok := b[key]
+	switch {
+	case !aok:
+		d.out = append(d.out, Change{Type: ChangeAdded, Kind: kind, Name: name, Path: path, New: bv})
+	case !bok:
+		d.out = append(d.out, Change{Type: ChangeRemoved, Kind: kind, Name: name, Path: path, Old: av})
+	default:
+		d.value(kind, name, path, av, bv)
+	}
+}
+
+func (d *differ) list(kind, name, path string, a, b []interface{}) {
+	aIdx, bIdx := indexByName(a), indexByName(b)
+	if aIdx != nil && bIdx != nil {
+		for _, elem := range unionNames(a, b) {
+			elemPath := fmt.Sprintf("%s[%s]", path, elem)
+			av, aok := aIdx[elem]
+			bv, bok := bIdx[elem]
+			switch {
+			case !aok:
+				d.out = append(d.out, Change{Type: ChangeAdded, Kind: kind, Name: name, Path: elemPath, New: bv})
+			case !bok:
+				d.out = append(d.out, Change{Type: ChangeRemoved, Kind: kind, Name: name, Path: elemPath, Old: av})
+			default:
+				d.value(kind, name, elemPath, av, bv)
+			}
+		}
+		return
+	}
+
+	for idx := 0; idx < len(a) || idx < len(b); idx++ {
+		elemPath := fmt.Sprintf("%s[%d]", path, idx)
+		switch {
+		case idx >= len(a):
+			d.out = append(d.out, Change{Type: ChangeAdded, Kind: kind, Name: name, Path: elemPath, New: b[idx]})
+		case idx >= len(b):
+			d.out = append(d.out, Change{Type: ChangeRemoved, Kind: kind, Name: name, Path: elemPath, Old: a[idx]})
+		default:
+			d.value(kind, name, elemPath, a[idx], b[idx])
+		}
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// indexByName maps the "name" field of each element of the list to the
+// element. It returns nil if any element is not an object with a
+// unique, non-empty name.
+func indexByName(list []interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(list))
+	for _, elem := range list {
+		obj, ok := elem.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		name, ok := obj["name"].(string)
+		if !ok || name == "" {
+			return nil
+		}
+		if _, ok := out[name]; ok {
+			return nil
+		}
+		out[name] = elem
+	}
+	return out
+}
+
+// unionNames returns the names of the elements of a, followed by the
+// names of the elements of b that are not in a.
+func unionNames(a, b []interface{}) []string {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, list := range [][]interface{}{a, b} {
+		for _, elem := range list {
+			obj, _ := elem.(map[string]interface{})
+			name, _ := obj["name"].(string)
+			if !seen[name] {
+				seen[name] = true
+				out = append(out, name)
+			}
+		}
+	}
+	return out
+}
+
+func unionKeys(a, b map[string]interface{}) []string {
+	keys := []string{}
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,84 @@
+package shrub
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	build := func() *Configuration {
+		conf := &Configuration{}
+		conf.Function("setup").Command().Command("git.get_project").Param("directory", "src")
+		conf.Function("build").Append(
+			&CommandDefinition{FunctionName: "setup"},
+			&CommandDefinition{CommandName: "shell.exec", Params: map[string]interface{}{"script": "make"}},
+		)
+		conf.Task("compile").Function("build")
+		conf.Task("lint").Function("setup")
+		conf.TaskGroup("checks").Task("lint")
+		conf.Variant("ubuntu").RunOn("ubuntu2204").AddTasks("compile", "lint")
+		conf.Variant("windows").AddTasks("compile")
+		return conf
+	}
+
+	t.Run("Identical", func(t *testing.T) {
+		changes := Diff(build(), build())
+		assert(t, len(changes) == 0)
+	})
+	t.Run("Nil", func(t *testing.T) {
+		changes := Diff(nil, nil)
+		assert(t, len(changes) == 0)
+
+		changes = Diff(nil, build())
+		assert(t, len(changes) == 7)
+		for _, c := range changes {
+			assert(t, c.Type == ChangeAdded && c.Path == "" && c.New != nil, c.String())
+		}
+	})
+	t.Run("Changes", func(t *testing.T) {
+		a, b := build(), build()
+		(*b.Functions["build"])[1].Param("script", "make all")
+		b.Task("compile").Priority(10)
+		b.Task("test").Function("build")
+		b.Groups = nil
+		b.Variant("ubuntu").AddTasks("test", "package").TaskSpecs = b.Variant("ubuntu").TaskSpecs[1:]
+		b.Variant("ubuntu").Expansion("goos", "linux")
+
+		changes := Diff(a, b)
+
+		lines := []string{}
+		for _, c := range changes {
+			lines = append(lines, c.String())
+		}
+		expected := []string{
+			`function build: modified [1].params.script: "make" -> "make all"`,
+			`task compile: added priority (10)`,
+			`added task test`,
+			`removed task_group checks`,
+			`variant ubuntu: added expansions ({"goos":"linux"})`,
+			`variant ubuntu: removed tasks[compile] ({"name":"compile"})`,
+			`variant ubuntu: added tasks[test] ({"name":"test"})`,
+			`variant ubuntu: added tasks[package] ({"name":"package"})`,
+		}
+		assert(t, strings.Join(lines, "\n") == strings.Join(expected, "\n"), strings.Join(lines, "\n"))
+
+		buf := &bytes.Buffer{}
+		require(t, WriteChangesText(buf, changes) == nil)
+		assert(t, buf.String() == strings.Join(expected, "\n")+"\n")
+
+		buf.Reset()
+		require(t, WriteChangesJSON(buf, changes) == nil)
+		decoded := []Change{}
+		require(t, json.Unmarshal(buf.Bytes(), &decoded) == nil)
+		require(t, len(decoded) == len(changes))
+		assert(t, decoded[0].Type == ChangeModified && decoded[0].Kind == "function" && decoded[0].Name == "build")
+		assert(t, decoded[0].Path == "[1].params.script" && decoded[0].Old == "make" && decoded[0].New == "make all")
+	})
+	t.Run("EmptyJSON", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		require(t, WriteChangesJSON(buf, nil) == nil)
+		assert(t, strings.TrimSpace(buf.String()) == "[]")
+	})
+}
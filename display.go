@@ -0,0 +1,73 @@
+package shrub
+
+import "strings"
+
+// DisplayTaskByPrefix adds the tasks that run on the build variant and
+// whose names start with the prefix to the variant's display task of
+// the specified name, creating the display task if necessary. For
+// example, DisplayTaskByPrefix("ubuntu", "tests", "test_shard_")
+// groups every test shard into a single "tests" display task.
+//
+// Tasks that are already in another of the variant's display tasks are
+// not added, and no display task is created if no tasks match. The
+// build variant is created if it does not exist, and is returned.
+func (c *Configuration) DisplayTaskByPrefix(variant, name, prefix string) *Variant {
+	return c.groupDisplayTask(variant, name, func(t *Task) bool {
+		return strings.HasPrefix(t.Name, prefix)
+	})
+}
+
+// DisplayTaskByTag adds the tasks that run on the build variant and
+// have the tag to the variant's display task of the specified name, in
+// the same way as DisplayTaskByPrefix.
+func (c *Configuration) DisplayTaskByTag(variant, name, tag string) *Variant {
+	return c.groupDisplayTask(variant, name, func(t *Task) bool {
+		return containsString(t.Tags, tag)
+	})
+}
+
+func (c *Configuration) groupDisplayTask(variant, name string, match func(*Task) bool) *Variant {
+	v := c.Variant(variant)
+
+	idx := -1
+	grouped := map[string]bool{}
+	for i, dt := range v.DisplayTaskSpecs {
+		if dt.Name == name {
+			idx = i
+			continue
+		}
+		for _, component := range dt.Components {
+			grouped[component] = true
+		}
+	}
+
+	components := []string{}
+	for _, taskName := range c.variantTasks(v) {
+		if t := c.findTask(taskName); t != nil && !grouped[taskName] && match(t) {
+			components = append(components, taskName)
+		}
+	}
+
+	switch {
+	case idx >= 0:
+		v.DisplayTaskSpecs[idx].Components = unionStrings(v.DisplayTaskSpecs[idx].Components, components)
+	case len(components) > 0:
+		v.DisplayTasks(DisplayTaskDefinition{Name: name, Components: components})
+	}
+
+	return v
+}
+
+// variantTasks returns the names of the tasks that run on the build
+// variant, in the order in which its task specs add them.
+func (c *Configuration) variantTasks(v *Variant) []string {
+	out := []string{}
+	for _, spec := range v.TaskSpecs {
+		for _, name := range c.taskSpecTasks(spec) {
+			if !containsString(out, name) {
+				out = append(out, name)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,53 @@
+package shrub
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDisplayTaskGrouping(t *testing.T) {
+	build := func() *Configuration {
+		conf := &Configuration{}
+		for _, name := range []string{"compile", "test_shard_0", "test_shard_1", "test_shard_2", "lint"} {
+			conf.Task(name)
+		}
+		conf.Task("lint").Tag("check")
+		conf.Task("compile").Tag("check")
+		conf.TaskGroup("shards").Task("test_shard_1", "test_shard_2")
+		conf.Task("test_shard_9")
+		conf.Variant("ubuntu").AddTasks("compile", "test_shard_0", "shards", "lint")
+		return conf
+	}
+
+	t.Run("ByPrefix", func(t *testing.T) {
+		conf := build()
+		v := conf.DisplayTaskByPrefix("ubuntu", "tests", "test_shard_")
+		assert(t, v == conf.Variant("ubuntu"))
+		require(t, len(v.DisplayTaskSpecs) == 1)
+		assert(t, v.DisplayTaskSpecs[0].Name == "tests")
+		assert(t, strings.Join(v.DisplayTaskSpecs[0].Components, ",") == "test_shard_0,test_shard_1,test_shard_2",
+			strings.Join(v.DisplayTaskSpecs[0].Components, ","), "only tasks that run on the variant are grouped")
+		assert(t, conf.Validate() == nil, errString(conf.Validate()))
+
+		conf.Variant("ubuntu").AddTasks("test_shard_9")
+		conf.DisplayTaskByPrefix("ubuntu", "tests", "test_shard_")
+		require(t, len(v.DisplayTaskSpecs) == 1, "existing display tasks are extended")
+		assert(t, len(v.DisplayTaskSpecs[0].Components) == 4)
+	})
+	t.Run("ByTag", func(t *testing.T) {
+		conf := build()
+		conf.Variant("ubuntu").DisplayTasks(DisplayTaskDefinition{Name: "build", Components: []string{"compile"}})
+		v := conf.DisplayTaskByTag("ubuntu", "checks", "check")
+		require(t, len(v.DisplayTaskSpecs) == 2)
+		assert(t, strings.Join(v.DisplayTaskSpecs[1].Components, ",") == "lint",
+			"tasks already in another display task are not added")
+		assert(t, conf.Validate() == nil, errString(conf.Validate()))
+	})
+	t.Run("NoMatches", func(t *testing.T) {
+		conf := build()
+		v := conf.DisplayTaskByTag("ubuntu", "slow", "slow")
+		assert(t, len(v.DisplayTaskSpecs) == 0)
+		v = conf.DisplayTaskByPrefix("windows", "tests", "test_")
+		assert(t, v.BuildName == "windows" && len(v.DisplayTaskSpecs) == 0)
+	})
+}
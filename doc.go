@@ -47,7 +47,19 @@
 //	res, err := json.MarshalIndent(conf, "", "    ")
 //	fmt.Println(res)
 //
+//	// Alternatively, write the configuration out as YAML (or JSON)
+//	// with a stable key order.
+//	err = conf.Write(os.Stdout, shrub.YAML)
+//
+// Configurations can also be read back with ReadConfiguration.
+//
+// Project settings that cannot be generated, such as modules, pre and
+// post commands and the default command type, can also be set (see
+// Configuration.Module and Configuration.Pre), so that whole project
+// files can be written with shrub.
+//
 // Be aware that some command methods will panic if you attempt to
 // construct an invalid command. You can wrap your configuration logic with
-// BuildConfiguration to convert any panic into an error.
+// BuildConfiguration to convert any panic into an error, or with
+// BuildConfigurationCollect to report every invalid command at once.
 package shrub
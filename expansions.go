@@ -0,0 +1,234 @@
+package shrub
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultBuiltinExpansions lists the expansions that Evergreen defines
+// for every task. Pass them to AnalyzeExpansions, along with any
+// project-level expansions, to avoid reporting them as undefined.
+var DefaultBuiltinExpansions = []string{
+	"author",
+	"author_email",
+	"branch_name",
+	"build_id",
+	"build_variant",
+	"created_at",
+	"distro_id",
+	"execution",
+	"github_author",
+	"github_commit",
+	"github_known_hosts",
+	"github_org",
+	"github_pr_head_branch",
+	"github_pr_number",
+	"github_repo",
+	"is_commit_queue",
+	"is_patch",
+	"project",
+	"project_id",
+	"project_identifier",
+	"requester",
+	"revision",
+	"revision_order_id",
+	"task_id",
+	"task_name",
+	"triggered_by_git_tag",
+	"version_id",
+	"workdir",
+}
+
+// ExpansionReference is a single reference to an expansion, written as
+// ${name} or ${name|default}.
+type ExpansionReference struct {
+	Name string
+	// Default is the value used if the expansion is not defined. A
+	// default beginning with "*" (e.g. ${name|*other}) names another
+	// expansion to use instead.
+	Default    string
+	HasDefault bool
+	// Path identifies the string containing the reference, e.g.
+	// "tasks[compile].commands[0].params.script".
+	Path string
+}
+
+func (r ExpansionReference) String() string {
+	if r.HasDefault {
+		return fmt.Sprintf("${%s|%s}", r.Name, r.Default)
+	}
+	return fmt.Sprintf("${%s}", r.Name)
+}
+
+// ParseExpansions returns the expansion references in the string, in
+// the order in which they appear. Unterminated references are ignored.
+func ParseExpansions(s string) []ExpansionReference {
+	out := []ExpansionReference{}
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			return out
+		}
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
+			return out
+		}
+
+		ref := ExpansionReference{Name: s[start+2 : start+end]}
+		if idx := strings.Index(ref.Name, "|"); idx >= 0 {
+			ref.Default = ref.Name[idx+1:]
+			ref.HasDefault = true
+			ref.Name = ref.Name[:idx]
+		}
+		out = append(out, ref)
+
+		s = s[start+end+1:]
+	}
+}
+
+// ExpansionReport describes the expansions that a configuration uses
+// and defines.
+type ExpansionReport struct {
+	// References contains every expansion reference in the
+	// configuration.
+	References []ExpansionReference
+	// Defined contains the sorted names of the expansions that the
+	// configuration defines, along with the built-in expansions.
+	Defined []string
+	// Undefined contains the references, without defaults, to
+	// expansions that are not defined.
+	Undefined []ExpansionReference
+}
+
+// Used returns the sorted names of every expansion referenced by the
+// configuration.
+func (r *ExpansionReport) Used() []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, ref := range r.References {
+		if !seen[ref.Name] {
+			seen[ref.Name] = true
+			out = append(out, ref.Name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Uses returns the references to the named expansion.
+func (r *ExpansionReport) Uses(name string) []ExpansionReference {
+	out := []ExpansionReference{}
+	for _, ref := range r.References {
+		if ref.Name == name {
+			out = append(out, ref)
+		}
+	}
+	return out
+}
+
+// AnalyzeExpansions finds every expansion reference in the strings of
+// the configuration, and reports the references to expansions that are
+// not defined by the configuration or by the list of built-in
+// expansions (such as DefaultBuiltinExpansions).
+//
+// The configuration defines the keys of build variant expansions, the
+// vars of function calls, the keys set by expansions.update commands
+// and the expansions written by github.generate_token commands.
+// Expansions that are only set at runtime, for example by loading them
+// from a file, must be included in the built-in expansions to avoid
+// reporting them as undefined.
+func (c *Configuration) AnalyzeExpansions(builtins ...string) *ExpansionReport {
+	a := &expansionAnalyzer{defined: map[string]bool{}}
+	for _, name := range builtins {
+		a.defined[name] = true
+	}
+
+	tree := configurationTree(c)
+	for _, key := range sortedKeys(tree) {
+		switch val := tree[key].(type) {
+		case map[string]interface{}:
+			for _, name := range sortedKeys(val) {
+				a.walk(fmt.Sprintf("%s[%s]", key, name), val[name])
+			}
+		default:
+			a.walk(key, val)
+		}
+	}
+
+	if variants, ok := tree["buildvariants"].([]interface{}); ok {
+		for _, v := range variants {
+			obj, _ := v.(map[string]interface{})
+			expansions, _ := obj["expansions"].(map[string]interface{})
+			for name := range expansions {
+				a.defined[name] = true
+			}
+		}
+	}
+
+	report := &ExpansionReport{References: a.refs, Defined: sortedKeys(a.defined), Undefined: []ExpansionReference{}}
+	for _, ref := range a.refs {
+		if !ref.HasDefault && !a.defined[ref.Name] {
+			report.Undefined = append(report.Undefined, ref)
+		}
+	}
+
+	return report
+}
+
+type expansionAnalyzer struct {
+	refs    []ExpansionReference
+	defined map[string]bool
+}
+
+func (a *expansionAnalyzer) walk(path string, val interface{}) {
+	switch v := val.(type) {
+	case string:
+		for _, ref := range ParseExpansions(v) {
+			ref.Path = path
+			a.refs = append(a.refs, ref)
+		}
+	case map[string]interface{}:
+		a.define(v)
+		for _, key := range sortedKeys(v) {
+			a.walk(joinPath(path, key), v[key])
+		}
+	case []interface{}:
+		names := indexByName(v)
+		for idx, elem := range v {
+			if names != nil {
+				a.walk(fmt.Sprintf("%s[%s]", path, elem.(map[string]interface{})["name"]), elem)
+			} else {
+				a.walk(fmt.Sprintf("%s[%d]", path, idx), elem)
+			}
+		}
+	}
+}
+
+// define records the expansions defined by the object, if it is a
+// command definition.
+func (a *expansionAnalyzer) define(obj map[string]interface{}) {
+	if _, ok := obj["func"].(string); ok {
+		vars, _ := obj["vars"].(map[string]interface{})
+		for name := range vars {
+			a.defined[name] = true
+		}
+		return
+	}
+
+	params, _ := obj["params"].(map[string]interface{})
+	switch obj["command"] {
+	case "expansions.update":
+		updates, _ := params["updates"].([]interface{})
+		for _, update := range updates {
+			u, _ := update.(map[string]interface{})
+			if key, ok := u["key"].(string); ok && key != "" {
+				a.defined[key] = true
+			}
+		}
+	case "github.generate_token":
+		if name, ok := params["expansion_name"].(string); ok && name != "" {
+			a.defined[name] = true
+		}
+	}
+}
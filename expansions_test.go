@@ -0,0 +1,71 @@
+package shrub
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseExpansions(t *testing.T) {
+	cases := map[string][]ExpansionReference{
+		"":                         {},
+		"no references":            {},
+		"${workdir}/src":           {{Name: "workdir"}},
+		"${a}${b|}":                {{Name: "a"}, {Name: "b", HasDefault: true}},
+		"${python|python3} -m pip": {{Name: "python", Default: "python3", HasDefault: true}},
+		"${a|*b}":                  {{Name: "a", Default: "*b", HasDefault: true}},
+		"${unterminated":           {},
+		"$workdir ${ok} ${bad":     {{Name: "ok"}},
+	}
+
+	for input, expected := range cases {
+		t.Run(input, func(t *testing.T) {
+			refs := ParseExpansions(input)
+			require(t, len(refs) == len(expected))
+			for idx := range refs {
+				assert(t, refs[idx] == expected[idx], refs[idx].String())
+			}
+		})
+	}
+}
+
+func TestAnalyzeExpansions(t *testing.T) {
+	conf := &Configuration{}
+	conf.Function("setup").Add(CmdGetProject{Directory: "${workdir}/src"})
+	conf.Function("test").Add(CmdExecShell{Script: "cd ${workdri} && ${go|go} test ${pkg}"})
+	conf.Task("test").FunctionWithVars("test", map[string]string{"pkg": "./..."}).
+		Command(
+			CmdExpansionsUpdate{Updates: []ExpansionUpdateParams{{Key: "version", Value: "${revision}"}}},
+			CmdGitHubGenerateToken{ExpansionName: "token"},
+			CmdExec{Binary: "release", Args: []string{"${version}", "${token}", "${gopath}"}},
+		)
+	conf.Variant("ubuntu").AddTasks("test").Expansion("gopath", "/opt/go").DisplayName("Ubuntu ${distro}")
+
+	report := conf.AnalyzeExpansions(DefaultBuiltinExpansions...)
+
+	assert(t, strings.Join(report.Used(), ",") == "distro,go,gopath,pkg,revision,token,version,workdir,workdri",
+		strings.Join(report.Used(), ","))
+
+	undefined := []string{}
+	for _, ref := range report.Undefined {
+		undefined = append(undefined, ref.Path+": "+ref.String())
+	}
+	assert(t, strings.Join(undefined, "\n") == strings.Join([]string{
+		"buildvariants[ubuntu].display_name: ${distro}",
+		"functions[test][0].params.script: ${workdri}",
+	}, "\n"), strings.Join(undefined, "\n"))
+
+	uses := report.Uses("version")
+	require(t, len(uses) == 1)
+	assert(t, uses[0].Path == "tasks[test].commands[3].params.args[0]", uses[0].Path)
+
+	uses = report.Uses("workdir")
+	require(t, len(uses) == 1)
+	assert(t, uses[0].Path == "functions[setup][0].params.directory", uses[0].Path)
+
+	for _, name := range []string{"gopath", "pkg", "token", "version", "workdir"} {
+		assert(t, containsString(report.Defined, name), name)
+	}
+
+	report = conf.AnalyzeExpansions()
+	assert(t, len(report.Undefined) == 4, "built-ins are only those supplied")
+}
@@ -0,0 +1,225 @@
+package shrub
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// RemoveUnusedFunctions deletes the functions that are not called,
+// directly or through other functions, from any task or task group,
+// and returns their names in sorted order.
+func (c *Configuration) RemoveUnusedFunctions() []string {
+	roots := []CommandSequence{}
+	for _, seq := range c.commandSequences() {
+		if seq.function == "" {
+			roots = append(roots, *seq.commands)
+		}
+	}
+	used := c.functionsCalledBy(roots...)
+
+	removed := []string{}
+	for name := range c.Functions {
+		if !used[name] {
+			removed = append(removed, name)
+			delete(c.Functions, name)
+		}
+	}
+	if len(c.Functions) == 0 {
+		c.Functions = nil
+	}
+	sort.Strings(removed)
+
+	return removed
+}
+
+// InlineSingleUseFunctions replaces each function that is called
+// exactly once with its commands, removes it from the configuration,
+// and returns the names of the inlined functions in sorted order.
+//
+// A function is only inlined if doing so cannot change what runs. The
+// call must not set anything other than vars (e.g. a display name,
+// timeout or variant list). If the call sets vars, references to them
+// in the parameters of the function's commands are replaced with their
+// values; the function is not inlined if it calls other functions,
+// updates expansions, or refers to its vars in any other way that
+// cannot be replaced. Recursive functions are never inlined.
+func (c *Configuration) InlineSingleUseFunctions() []string {
+	names := make([]string, 0, len(c.Functions))
+	for name := range c.Functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	inlined := []string{}
+	for _, name := range names {
+		if c.inlineFunction(name) {
+			inlined = append(inlined, name)
+		}
+	}
+	if len(c.Functions) == 0 {
+		c.Functions = nil
+	}
+
+	return inlined
+}
+
+func (c *Configuration) inlineFunction(name string) bool {
+	var (
+		site  namedSequence
+		idx   int
+		calls int
+	)
+	for _, seq := range c.commandSequences() {
+		for i, cmd := range *seq.commands {
+			if cmd != nil && cmd.FunctionName == name {
+				site, idx = seq, i
+				calls++
+			}
+		}
+	}
+	if calls != 1 || site.function == name {
+		return false
+	}
+
+	call := (*site.commands)[idx]
+	if !isPlainFunctionCall(call) {
+		return false
+	}
+
+	var body CommandSequence
+	if fn := c.Functions[name]; fn != nil {
+		var ok bool
+		if body, ok = inlineBody(*fn, call.Vars); !ok {
+			return false
+		}
+	}
+
+	seq := make(CommandSequence, 0, len(*site.commands)+len(body)-1)
+	seq = append(seq, (*site.commands)[:idx]...)
+	seq = append(seq, body...)
+	seq = append(seq, (*site.commands)[idx+1:]...)
+	*site.commands = seq
+	delete(c.Functions, name)
+
+	return true
+}
+
+// isPlainFunctionCall reports whether the command is a function call
+// that sets nothing other than vars.
+func isPlainFunctionCall(cmd *CommandDefinition) bool {
+	return cmd.CommandName == "" &&
+		cmd.ExecutionType == "" &&
+		cmd.DisplayName == "" &&
+		len(cmd.RunVariants) == 0 &&
+		cmd.TimeoutSecs == 0 &&
+		!cmd.RetryOnFailure &&
+		len(cmd.FailureMetadataTags) == 0 &&
+		len(cmd.Params) == 0
+}
+
+// inlineBody returns the commands of a function body with the call's
+// vars substituted into them, and reports whether that was possible.
+func inlineBody(fn CommandSequence, vars map[string]string) (CommandSequence, bool) {
+	if len(vars) == 0 {
+		return append(CommandSequence{}, fn...), true
+	}
+
+	out := make(CommandSequence, 0, len(fn))
+	for _, cmd := range fn {
+		if cmd == nil {
+			continue
+		}
+		if cmd.FunctionName != "" || cmd.CommandName == "expansions.update" {
+			return nil, false
+		}
+		for _, s := range append([]string{cmd.DisplayName, cmd.ExecutionType}, cmd.RunVariants...) {
+			if refersToVars(s, vars) {
+				return nil, false
+			}
+		}
+
+		inlined := *cmd
+		if cmd.Params != nil {
+			data, err := json.Marshal(cmd.Params)
+			if err != nil {
+				return nil, false
+			}
+			params := map[string]interface{}{}
+			if err := json.Unmarshal(data, &params); err != nil {
+				return nil, false
+			}
+			if !substituteVarsInValue(params, vars) {
+				return nil, false
+			}
+			inlined.Params = params
+		}
+		out = append(out, &inlined)
+	}
+
+	return out, true
+}
+
+// substituteVars replaces references to the vars in the string with
+// their values. It reports false if the string refers to a var in a way
+// that depends on whether other expansions are defined.
+func substituteVars(s string, vars map[string]string) (string, bool) {
+	ok := true
+	out := replaceExpansions(s, func(ref ExpansionReference, raw string) string {
+		if val, defined := vars[ref.Name]; defined {
+			return val
+		}
+		if strings.HasPrefix(ref.Default, "*") {
+			if _, defined := vars[ref.Default[1:]]; defined {
+				ok = false
+			}
+		}
+		return raw
+	})
+	return out, ok
+}
+
+// refersToVars reports whether the string refers to any of the vars.
+func refersToVars(s string, vars map[string]string) bool {
+	for _, ref := range ParseExpansions(s) {
+		if _, ok := vars[ref.Name]; ok {
+			return true
+		}
+		if strings.HasPrefix(ref.Default, "*") {
+			if _, ok := vars[ref.Default[1:]]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func substituteVarsInValue(val interface{}, vars map[string]string) bool {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		for k, elem := range v {
+			if s, ok := elem.(string); ok {
+				sub, ok := substituteVars(s, vars)
+				if !ok {
+					return false
+				}
+				v[k] = sub
+			} else if !substituteVarsInValue(elem, vars) {
+				return false
+			}
+		}
+	case []interface{}:
+		for idx, elem := range v {
+			if s, ok := elem.(string); ok {
+				sub, ok := substituteVars(s, vars)
+				if !ok {
+					return false
+				}
+				v[idx] = sub
+			} else if !substituteVarsInValue(elem, vars) {
+				return false
+			}
+		}
+	}
+	return true
+}
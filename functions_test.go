@@ -0,0 +1,110 @@
+package shrub
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRemoveUnusedFunctions(t *testing.T) {
+	t.Run("Empty", func(t *testing.T) {
+		conf := &Configuration{}
+		assert(t, len(conf.RemoveUnusedFunctions()) == 0)
+	})
+	t.Run("Reachability", func(t *testing.T) {
+		conf := &Configuration{}
+		conf.Function("setup").Add(CmdGetProject{Directory: "src"})
+		conf.Function("build").Append(&CommandDefinition{FunctionName: "setup"})
+		conf.Function("cleanup").Add(CmdExec{Binary: "rm"})
+		conf.Function("stale").Append(&CommandDefinition{FunctionName: "older"})
+		conf.Function("older").Add(CmdExec{Binary: "true"})
+		conf.Function("loop").Append(&CommandDefinition{FunctionName: "loop"})
+		conf.Task("compile").Function("build")
+		conf.TaskGroup("group").Task("compile").TeardownGroup.Append(&CommandDefinition{FunctionName: "cleanup"})
+
+		removed := conf.RemoveUnusedFunctions()
+		assert(t, strings.Join(removed, ",") == "loop,older,stale", strings.Join(removed, ","))
+		assert(t, len(conf.Functions) == 3)
+		assert(t, conf.Validate() == nil, errString(conf.Validate()))
+
+		assert(t, len(conf.RemoveUnusedFunctions()) == 0, "removal is idempotent")
+	})
+	t.Run("InlineTaskGroup", func(t *testing.T) {
+		conf := &Configuration{}
+		conf.Function("setup").Add(CmdGetProject{Directory: "src"})
+		conf.Function("stale")
+		conf.Task("compile")
+		spec := TaskSpec{Name: "group"}
+		spec.SetTaskGroup(TaskGroup{
+			Tasks:      []string{"compile"},
+			SetupGroup: CommandSequence{{FunctionName: "setup"}},
+		})
+		conf.Variant("ubuntu").TaskSpec(spec)
+
+		removed := conf.RemoveUnusedFunctions()
+		assert(t, strings.Join(removed, ",") == "stale", strings.Join(removed, ","))
+		assert(t, conf.Functions["setup"] != nil, "functions called by inline task group hooks are used")
+	})
+	t.Run("AllUnused", func(t *testing.T) {
+		conf := &Configuration{}
+		conf.Function("stale")
+		assert(t, strings.Join(conf.RemoveUnusedFunctions(), ",") == "stale")
+		assert(t, conf.Functions == nil)
+	})
+}
+
+func TestInlineSingleUseFunctions(t *testing.T) {
+	t.Run("Inlined", func(t *testing.T) {
+		conf := &Configuration{}
+		conf.Function("setup").Add(CmdGetProject{Directory: "src"})
+		conf.Function("build").Append(&CommandDefinition{FunctionName: "setup"}).
+			Add(CmdExecShell{Script: "make ${target} ${flags|-j4}"})
+		conf.Function("shared").Add(CmdExec{Binary: "true"})
+		conf.Task("compile").
+			FunctionWithVars("build", map[string]string{"target": "all"}).
+			Function("shared")
+		conf.Task("test").Function("shared")
+
+		inlined := conf.InlineSingleUseFunctions()
+		assert(t, strings.Join(inlined, ",") == "setup", strings.Join(inlined, ","),
+			"functions that call functions are not inlined with vars")
+		assert(t, len(conf.Functions) == 2)
+		build := *conf.Functions["build"]
+		require(t, len(build) == 2)
+		assert(t, build[0].CommandName == "git.get_project")
+	})
+	t.Run("Vars", func(t *testing.T) {
+		conf := &Configuration{}
+		conf.Function("build").Add(CmdExecShell{Script: "make ${target} ${flags|-j4} ${other}"}).
+			Add(CmdExec{Binary: "echo", Args: []string{"${target|none}"}})
+		conf.Task("compile").Function("prepare").FunctionWithVars("build", map[string]string{"target": "all"})
+		conf.Function("prepare").Add(CmdExec{Binary: "true"})
+
+		inlined := conf.InlineSingleUseFunctions()
+		assert(t, strings.Join(inlined, ",") == "build,prepare", strings.Join(inlined, ","))
+		assert(t, conf.Functions == nil)
+
+		cmds := conf.Tasks[0].Commands
+		require(t, len(cmds) == 3)
+		assert(t, cmds[0].Params["binary"] == "true")
+		assert(t, cmds[1].Params["script"] == "make all ${flags|-j4} ${other}", cmds[1].Params["script"].(string))
+		assert(t, cmds[2].Params["args"].([]interface{})[0] == "all")
+	})
+	t.Run("NotInlined", func(t *testing.T) {
+		conf := &Configuration{}
+		conf.Function("twice").Add(CmdExec{Binary: "true"})
+		conf.Function("decorated").Add(CmdExec{Binary: "true"})
+		conf.Function("fallback").Add(CmdExecShell{Script: "${a|*target}"})
+		conf.Function("updates").Add(CmdExpansionsUpdate{Updates: []ExpansionUpdateParams{{Key: "x", Value: "${target}"}}})
+		conf.Function("recursive").Append(&CommandDefinition{FunctionName: "recursive"})
+		vars := map[string]string{"target": "all"}
+		conf.Task("compile").
+			Function("twice", "twice").
+			FunctionWithVars("fallback", vars).
+			FunctionWithVars("updates", vars).
+			AddCommand().Function("decorated").Name("decorated call")
+
+		assert(t, len(conf.InlineSingleUseFunctions()) == 0)
+		assert(t, len(conf.Functions) == 5)
+		assert(t, len(conf.Tasks[0].Commands) == 5)
+	})
+}
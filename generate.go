@@ -0,0 +1,115 @@
+package shrub
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WriteGenerateTasksFile validates the configuration as a fragment of
+// the project (see ValidateFragment), so that the generated tasks and
+// variants may refer to functions, tasks and variants already in the
+// project, and writes it to the given path as a JSON payload for the
+// generate.tasks command. The file is written atomically, so a
+// concurrently running (or crashed) generator never leaves a partial
+// payload behind.
+//
+// Project settings, such as modules and pre and post commands, cannot
+// be generated, so WriteGenerateTasksFile returns an error if the
+// configuration sets any of them.
+func (c *Configuration) WriteGenerateTasksFile(path string) error {
+	if err := c.ValidateFragment(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	if c.hasProjectSettings() {
+		return errGenerateProjectSettings
+	}
+
+	payload, err := c.generateTasksPayload()
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, payload, 0644)
+}
+
+var errGenerateProjectSettings = errors.New("generate.tasks cannot set project settings, only functions, tasks, task groups and build variants")
+
+// generateTasksPayload renders the configuration as compact JSON, which
+// is the form that counts against Evergreen's generate.tasks size limit.
+func (c *Configuration) generateTasksPayload() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(c); err != nil {
+		return nil, fmt.Errorf("encoding generate.tasks payload: %w", err)
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// projectSettings returns a copy of the configuration without its
+// functions, tasks, task groups and build variants.
+func (c *Configuration) projectSettings() Configuration {
+	out := *c
+	out.Functions = nil
+	out.Tasks = nil
+	out.Groups = nil
+	out.Variants = nil
+	out.collector = nil
+	return out
+}
+
+// hasProjectSettings reports whether the configuration sets anything
+// other than functions, tasks, task groups and build variants. Empty
+// lists, such as those produced by decoding "pre: []", are not
+// settings.
+func (c *Configuration) hasProjectSettings() bool {
+	return c.CommandType != "" ||
+		c.Stepback != nil ||
+		len(c.IgnoredFiles) > 0 ||
+		c.ExecTimeoutSecs != 0 ||
+		c.CallbackTimeoutSecs != 0 ||
+		c.PreTimeoutSecs != 0 ||
+		c.PostTimeoutSecs != 0 ||
+		c.PreErrorFailsTask ||
+		c.PostErrorFailsTask ||
+		len(c.PreCommands) > 0 ||
+		len(c.PostCommands) > 0 ||
+		len(c.TimeoutCommands) > 0 ||
+		len(c.Modules) > 0
+}
+
+// writeFileAtomic writes the data to a temporary file in the same
+// directory as path and renames it into place, with the given
+// permissions, once it is complete.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
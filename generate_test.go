@@ -0,0 +1,122 @@
+package shrub
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteGenerateTasksFile(t *testing.T) {
+	t.Run("ValidConfiguration", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "generated.json")
+
+		conf := &Configuration{}
+		conf.Task("compile").Command(CmdExecShell{Script: "make && echo <done>"})
+		conf.Variant("ubuntu").AddTasks("compile")
+
+		require(t, conf.WriteGenerateTasksFile(path) == nil)
+
+		data, err := os.ReadFile(path)
+		require(t, err == nil, errString(err))
+		out := &Configuration{}
+		require(t, json.Unmarshal(data, out) == nil, "payload is json")
+		require(t, len(out.Tasks) == 1)
+		assert(t, out.Tasks[0].Commands[0].Params["script"] == "make && echo <done>")
+
+		info, err := os.Stat(path)
+		require(t, err == nil, errString(err))
+		assert(t, info.Mode().Perm() == 0644, info.Mode().String())
+
+		entries, err := os.ReadDir(dir)
+		require(t, err == nil, errString(err))
+		assert(t, len(entries) == 1, "no temporary files are left behind")
+	})
+	t.Run("OverwritesExistingFile", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "generated.json")
+		require(t, os.WriteFile(path, []byte("old contents"), 0644) == nil)
+
+		conf := &Configuration{}
+		conf.Task("compile")
+		require(t, conf.WriteGenerateTasksFile(path) == nil)
+
+		data, err := os.ReadFile(path)
+		require(t, err == nil, errString(err))
+		assert(t, json.Valid(data), string(data))
+	})
+	t.Run("InvalidConfiguration", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "generated.json")
+
+		conf := &Configuration{}
+		conf.Task("compile").AddCommand()
+		assert(t, conf.WriteGenerateTasksFile(path) != nil)
+
+		conf = &Configuration{}
+		conf.Tasks = append(conf.Tasks, &Task{Name: "compile"}, &Task{Name: "compile"})
+		assert(t, conf.WriteGenerateTasksFile(path) != nil)
+
+		entries, err := os.ReadDir(dir)
+		require(t, err == nil, errString(err))
+		assert(t, len(entries) == 0, "nothing is written")
+	})
+	t.Run("EmptyProjectSettings", func(t *testing.T) {
+		conf, err := ReadConfiguration(strings.NewReader("pre: []\nmodules: []\nignore: []\ntasks:\n  - name: compile\n"), YAML)
+		require(t, err == nil, errString(err))
+		require(t, conf.PreCommands != nil && conf.Modules != nil && conf.IgnoredFiles != nil, "empty lists are decoded")
+		path := filepath.Join(t.TempDir(), "generated.json")
+		assert(t, conf.WriteGenerateTasksFile(path) == nil, errString(conf.WriteGenerateTasksFile(path)))
+
+		conf = &Configuration{Modules: []*Module{}, PostCommands: CommandSequence{}}
+		conf.Task("compile")
+		assert(t, conf.Clone().WriteGenerateTasksFile(path) == nil)
+	})
+	t.Run("ParentProjectReferences", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "generated.json")
+
+		conf := &Configuration{}
+		conf.Task("shard_0").Function("setup").Dependency(TaskDependency{Name: "compile", Variant: "ubuntu"})
+		conf.Variant("windows").AddTasks("shard_0", "compile").Module("enterprise").
+			DisplayTasks(DisplayTaskDefinition{Name: "shards", Components: []string{"shard_0", "lint"}})
+		assert(t, conf.Validate() != nil, "fragment refers to the parent project")
+		require(t, conf.WriteGenerateTasksFile(path) == nil, errString(conf.ValidateFragment()))
+
+		data, err := os.ReadFile(path)
+		require(t, err == nil, errString(err))
+		assert(t, json.Valid(data), string(data))
+	})
+	t.Run("ProjectSettings", func(t *testing.T) {
+		dir := t.TempDir()
+
+		conf := &Configuration{}
+		conf.Task("compile")
+		conf.Post().Add(CmdExec{Binary: "true"})
+		assert(t, conf.WriteGenerateTasksFile(filepath.Join(dir, "generated.json")) != nil)
+
+		conf = &Configuration{}
+		conf.Task("compile")
+		conf.SetStepback(false)
+		assert(t, conf.WriteGenerateTasksFile(filepath.Join(dir, "generated.json")) != nil)
+
+		entries, err := os.ReadDir(dir)
+		require(t, err == nil, errString(err))
+		assert(t, len(entries) == 0, "nothing is written")
+	})
+	t.Run("MissingDirectory", func(t *testing.T) {
+		conf := &Configuration{}
+		conf.Task("compile")
+		assert(t, conf.WriteGenerateTasksFile(filepath.Join(t.TempDir(), "missing", "generated.json")) != nil)
+	})
+	t.Run("ParentTask", func(t *testing.T) {
+		conf := &Configuration{}
+		conf.Task("generate").Command(CmdGenerateTasks{Files: []string{"generated.json"}})
+
+		cmd := conf.Tasks[0].Commands[0]
+		assert(t, cmd.CommandName == "generate.tasks")
+		typed, err := cmd.Typed()
+		require(t, err == nil, errString(err))
+		assert(t, typed.(CmdGenerateTasks).Files[0] == "generated.json")
+	})
+}
@@ -5,6 +5,7 @@ go 1.23.0
 require (
 	github.com/google/go-github/v73 v73.0.0
 	github.com/pkg/errors v0.9.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require github.com/google/go-querystring v1.1.0 // indirect
@@ -0,0 +1,314 @@
+package shrub
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MatrixAxis is a single dimension of a build variant matrix, such as
+// the operating system or the architecture.
+type MatrixAxis struct {
+	Name   string
+	Values []MatrixAxisValue
+}
+
+// MatrixAxisValue is one of the values of a matrix axis, along with
+// the variant settings that the value contributes to each variant that
+// includes it. When several axes contribute settings, run_on is taken
+// from the last axis that sets it, expansions are merged (with later
+// axes taking precedence), and tags are combined.
+type MatrixAxisValue struct {
+	ID          string
+	DisplayName string
+	RunOn       []string
+	Expansions  map[string]interface{}
+	Tags        []string
+}
+
+// MatrixCell identifies a single combination of axis values, mapping
+// each axis name to the ID of one of its values.
+type MatrixCell map[string]string
+
+// String returns the cell in the form used in the names of Evergreen
+// matrix variants, e.g. "arch~x86_os~linux".
+func (mc MatrixCell) String() string {
+	keys := make([]string, 0, len(mc))
+	for k := range mc {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s~%s", k, mc[k]))
+	}
+	return strings.Join(parts, "_")
+}
+
+// MatrixRule selects matrix cells by mapping axis names to the IDs of
+// the values to match. A cell matches a rule if, for every axis in the
+// rule, the cell's value is one of the listed values; the value "*"
+// matches any value.
+type MatrixRule map[string][]string
+
+// Matches reports whether the cell matches the rule.
+func (r MatrixRule) Matches(cell MatrixCell) bool {
+	for axis, values := range r {
+		matched := false
+		for _, val := range values {
+			if val == "*" || val == cell[axis] {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// Matrix builds a build variant for every combination of the values of
+// its axes, mirroring Evergreen's matrix variant definitions but
+// computed when the configuration is generated.
+type Matrix struct {
+	conf        *Configuration
+	id          string
+	displayName string
+	axes        []MatrixAxis
+	include     []MatrixRule
+	exclude     []MatrixRule
+	template    func(*Variant, MatrixCell)
+}
+
+// Matrix returns a new matrix builder with the given ID, which prefixes
+// the names of the variants it produces. The variants are added to the
+// configuration when the matrix is built.
+func (c *Configuration) Matrix(id string) *Matrix {
+	return &Matrix{conf: c, id: id}
+}
+
+// DisplayName sets the display name of the variants. Expansion-style
+// references to axis names (e.g. "Tests ${os} ${arch}") are replaced
+// with the display names of the cell's values; if the name contains no
+// such references, the display names of the cell's values are appended
+// to it in axis order.
+func (m *Matrix) DisplayName(name string) *Matrix { m.displayName = name; return m }
+
+// Axis adds a dimension to the matrix.
+func (m *Matrix) Axis(name string, values ...MatrixAxisValue) *Matrix {
+	m.axes = append(m.axes, MatrixAxis{Name: name, Values: values})
+	return m
+}
+
+// Include restricts the matrix to the cells that match at least one of
+// the include rules. By default, every combination is included.
+func (m *Matrix) Include(rules ...MatrixRule) *Matrix {
+	m.include = append(m.include, rules...)
+	return m
+}
+
+// Exclude removes the cells that match any of the rules from the
+// matrix.
+func (m *Matrix) Exclude(rules ...MatrixRule) *Matrix {
+	m.exclude = append(m.exclude, rules...)
+	return m
+}
+
+// Template sets a function that is called on every variant the matrix
+// produces, after the axis settings are applied, to add tasks and any
+// other settings.
+func (m *Matrix) Template(fn func(*Variant, MatrixCell)) *Matrix {
+	m.template = fn
+	return m
+}
+
+// Validate checks that the matrix and its rules are well formed.
+func (m *Matrix) Validate() error {
+	errs := []error{}
+	if m.id == "" {
+		errs = append(errs, errors.New("matrix must have an id"))
+	}
+	if len(m.axes) == 0 {
+		errs = append(errs, errors.New("matrix must have at least one axis"))
+	}
+
+	axes := map[string]map[string]bool{}
+	for _, axis := range m.axes {
+		switch {
+		case axis.Name == "":
+			errs = append(errs, errors.New("matrix axis must have a name"))
+		case axes[axis.Name] != nil:
+			errs = append(errs, fmt.Errorf("duplicate matrix axis '%s'", axis.Name))
+		}
+		if len(axis.Values) == 0 {
+			errs = append(errs, fmt.Errorf("matrix axis '%s' has no values", axis.Name))
+		}
+
+		values := map[string]bool{}
+		for _, val := range axis.Values {
+			switch {
+			case val.ID == "":
+				errs = append(errs, fmt.Errorf("matrix axis '%s' has a value without an id", axis.Name))
+			case values[val.ID]:
+				errs = append(errs, fmt.Errorf("matrix axis '%s' has duplicate value '%s'", axis.Name, val.ID))
+			}
+			values[val.ID] = true
+		}
+		axes[axis.Name] = values
+	}
+
+	for _, rule := range append(append([]MatrixRule{}, m.include...), m.exclude...) {
+		for axis, values := range rule {
+			known, ok := axes[axis]
+			if !ok {
+				errs = append(errs, fmt.Errorf("matrix rule refers to unknown axis '%s'", axis))
+				continue
+			}
+			for _, val := range values {
+				if val != "*" && !known[val] {
+					errs = append(errs, fmt.Errorf("matrix rule refers to unknown value '%s' of axis '%s'", val, axis))
+				}
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Cells returns every combination of axis values selected by the
+// matrix's include and exclude rules, in axis and value order.
+func (m *Matrix) Cells() ([]MatrixCell, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	cells := []MatrixCell{{}}
+	for _, axis := range m.axes {
+		next := make([]MatrixCell, 0, len(cells)*len(axis.Values))
+		for _, cell := range cells {
+			for _, val := range axis.Values {
+				c := make(MatrixCell, len(cell)+1)
+				for k, v := range cell {
+					c[k] = v
+				}
+				c[axis.Name] = val.ID
+				next = append(next, c)
+			}
+		}
+		cells = next
+	}
+
+	out := []MatrixCell{}
+	for _, cell := range cells {
+		if m.selected(cell) {
+			out = append(out, cell)
+		}
+	}
+
+	return out, nil
+}
+
+func (m *Matrix) selected(cell MatrixCell) bool {
+	for _, rule := range m.exclude {
+		if rule.Matches(cell) {
+			return false
+		}
+	}
+
+	if len(m.include) == 0 {
+		return true
+	}
+	for _, rule := range m.include {
+		if rule.Matches(cell) {
+			return true
+		}
+	}
+	return false
+}
+
+// VariantName returns the name of the variant produced for the cell,
+// following Evergreen's naming convention for matrix variants, e.g.
+// "tests__arch~x86_os~linux".
+func (m *Matrix) VariantName(cell MatrixCell) string {
+	return fmt.Sprintf("%s__%s", m.id, cell.String())
+}
+
+// Build adds a variant for every selected cell of the matrix to the
+// configuration and returns them in cell order. If a variant of the
+// same name already exists in the configuration, it is updated.
+func (m *Matrix) Build() ([]*Variant, error) {
+	cells, err := m.Cells()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*Variant, 0, len(cells))
+	for _, cell := range cells {
+		v := m.conf.Variant(m.VariantName(cell))
+		m.apply(v, cell)
+		if m.template != nil {
+			m.template(v, cell)
+		}
+		out = append(out, v)
+	}
+
+	return out, nil
+}
+
+func (m *Matrix) apply(v *Variant, cell MatrixCell) {
+	fragments := []string{}
+	displayNames := map[string]string{}
+	for _, axis := range m.axes {
+		val := axis.value(cell[axis.Name])
+
+		name := val.DisplayName
+		if name == "" {
+			name = val.ID
+		}
+		displayNames[axis.Name] = name
+		fragments = append(fragments, name)
+
+		if len(val.RunOn) > 0 {
+			v.DistroRunOn = append([]string{}, val.RunOn...)
+		}
+		for k, exp := range val.Expansions {
+			v.Expansion(k, exp)
+		}
+		for _, tag := range val.Tags {
+			if !containsString(v.Tags, tag) {
+				v.Tags = append(v.Tags, tag)
+			}
+		}
+	}
+
+	displayName := m.displayName
+	if strings.Contains(displayName, "${") {
+		for axis, name := range displayNames {
+			displayName = strings.ReplaceAll(displayName, "${"+axis+"}", name)
+		}
+	} else {
+		displayName = strings.TrimSpace(strings.Join(append([]string{displayName}, fragments...), " "))
+	}
+	v.DisplayName(displayName)
+}
+
+func (a MatrixAxis) value(id string) MatrixAxisValue {
+	for _, val := range a.Values {
+		if val.ID == id {
+			return val
+		}
+	}
+	return MatrixAxisValue{}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package shrub
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatrix(t *testing.T) {
+	cases := map[string]func(*testing.T, *Configuration){
+		"Cells": func(t *testing.T, conf *Configuration) {
+			m := conf.Matrix("tests").
+				Axis("os", MatrixAxisValue{ID: "linux"}, MatrixAxisValue{ID: "macos"}, MatrixAxisValue{ID: "windows"}).
+				Axis("arch", MatrixAxisValue{ID: "x86"}, MatrixAxisValue{ID: "arm"})
+
+			cells, err := m.Cells()
+			require(t, err == nil, errString(err))
+			require(t, len(cells) == 6)
+			assert(t, cells[0].String() == "arch~x86_os~linux", cells[0].String())
+			assert(t, cells[1].String() == "arch~arm_os~linux", cells[1].String())
+			assert(t, cells[5].String() == "arch~arm_os~windows", cells[5].String())
+		},
+		"IncludeAndExclude": func(t *testing.T, conf *Configuration) {
+			m := conf.Matrix("tests").
+				Axis("os", MatrixAxisValue{ID: "linux"}, MatrixAxisValue{ID: "macos"}, MatrixAxisValue{ID: "windows"}).
+				Axis("arch", MatrixAxisValue{ID: "x86"}, MatrixAxisValue{ID: "arm"}).
+				Include(MatrixRule{"os": {"linux", "macos"}}, MatrixRule{"arch": {"x86"}}).
+				Exclude(MatrixRule{"os": {"macos"}, "arch": {"*"}})
+
+			cells, err := m.Cells()
+			require(t, err == nil, errString(err))
+			names := []string{}
+			for _, cell := range cells {
+				names = append(names, m.VariantName(cell))
+			}
+			assert(t, strings.Join(names, " ") == "tests__arch~x86_os~linux tests__arch~arm_os~linux tests__arch~x86_os~windows",
+				strings.Join(names, " "))
+		},
+		"Build": func(t *testing.T, conf *Configuration) {
+			conf.Task("test")
+			variants, err := conf.Matrix("tests").DisplayName("Tests").
+				Axis("os",
+					MatrixAxisValue{ID: "macos", DisplayName: "macOS", RunOn: []string{"macos-14"}, Tags: []string{"unix"},
+						Expansions: map[string]interface{}{"shell": "zsh"}},
+					MatrixAxisValue{ID: "windows", DisplayName: "Windows", RunOn: []string{"windows-vsCurrent"},
+						Expansions: map[string]interface{}{"shell": "bash.exe"}},
+				).
+				Axis("arch",
+					MatrixAxisValue{ID: "x86", Tags: []string{"x86"}},
+					MatrixAxisValue{ID: "arm", DisplayName: "ARM", RunOn: []string{"arm-small"},
+						Expansions: map[string]interface{}{"shell": "sh", "arch": "arm64"}, Tags: []string{"unix"}},
+				).
+				Template(func(v *Variant, cell MatrixCell) {
+					v.AddTasks("test")
+					if cell["os"] == "windows" {
+						v.Expansion("exe", ".exe")
+					}
+				}).Build()
+			require(t, err == nil, errString(err))
+			require(t, len(variants) == 4)
+			require(t, len(conf.Variants) == 4, "variants are added to the configuration")
+
+			v := conf.findVariant("tests__arch~arm_os~macos")
+			require(t, v != nil)
+			assert(t, v.BuildDisplayName == "Tests macOS ARM", v.BuildDisplayName)
+			assert(t, len(v.DistroRunOn) == 1 && v.DistroRunOn[0] == "arm-small", "later axes override run_on")
+			assert(t, v.Expansions["shell"] == "sh", "later axes override expansions")
+			assert(t, v.Expansions["arch"] == "arm64")
+			assert(t, strings.Join(v.Tags, ",") == "unix", "tags are not duplicated")
+			assert(t, len(v.TaskSpecs) == 1 && v.TaskSpecs[0].Name == "test", "template is applied")
+
+			v = conf.findVariant("tests__arch~x86_os~windows")
+			require(t, v != nil)
+			assert(t, v.BuildDisplayName == "Tests Windows x86", "values without display names use their id")
+			assert(t, v.DistroRunOn[0] == "windows-vsCurrent")
+			assert(t, v.Expansions["shell"] == "bash.exe")
+			assert(t, v.Expansions["exe"] == ".exe")
+			assert(t, strings.Join(v.Tags, ",") == "x86")
+
+			assert(t, conf.Validate() == nil, errString(conf.Validate()))
+		},
+		"DisplayNameTemplate": func(t *testing.T, conf *Configuration) {
+			_, err := conf.Matrix("tests").DisplayName("${arch} tests on ${os}").
+				Axis("os", MatrixAxisValue{ID: "linux", DisplayName: "Linux"}).
+				Axis("arch", MatrixAxisValue{ID: "x86"}).
+				Build()
+			require(t, err == nil, errString(err))
+			v := conf.findVariant("tests__arch~x86_os~linux")
+			require(t, v != nil)
+			assert(t, v.BuildDisplayName == "x86 tests on Linux", v.BuildDisplayName)
+		},
+		"Deterministic": func(t *testing.T, conf *Configuration) {
+			second := &Configuration{}
+			for _, c := range []*Configuration{conf, second} {
+				_, err := c.Matrix("tests").
+					Axis("os",
+						MatrixAxisValue{ID: "linux", RunOn: []string{"ubuntu2204"}, Expansions: map[string]interface{}{"shell": "bash", "user": "root"}},
+						MatrixAxisValue{ID: "macos", RunOn: []string{"macos-14"}, Expansions: map[string]interface{}{"shell": "zsh"}},
+					).
+					Axis("arch", MatrixAxisValue{ID: "x86"}, MatrixAxisValue{ID: "arm", Expansions: map[string]interface{}{"arch": "arm64"}}).
+					Build()
+				require(t, err == nil, errString(err))
+			}
+
+			a, err := conf.Marshal(JSON)
+			require(t, err == nil, errString(err))
+			b, err := second.Marshal(JSON)
+			require(t, err == nil, errString(err))
+			assert(t, string(a) == string(b))
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			test(t, &Configuration{})
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		cases := map[string]*Matrix{
+			"NoID":             (&Configuration{}).Matrix("").Axis("os", MatrixAxisValue{ID: "linux"}),
+			"NoAxes":           (&Configuration{}).Matrix("tests"),
+			"EmptyAxis":        (&Configuration{}).Matrix("tests").Axis("os"),
+			"UnnamedAxis":      (&Configuration{}).Matrix("tests").Axis("", MatrixAxisValue{ID: "linux"}),
+			"DuplicateAxis":    (&Configuration{}).Matrix("tests").Axis("os", MatrixAxisValue{ID: "linux"}).Axis("os", MatrixAxisValue{ID: "macos"}),
+			"DuplicateValue":   (&Configuration{}).Matrix("tests").Axis("os", MatrixAxisValue{ID: "linux"}, MatrixAxisValue{ID: "linux"}),
+			"ValueWithoutID":   (&Configuration{}).Matrix("tests").Axis("os", MatrixAxisValue{DisplayName: "Linux"}),
+			"RuleUnknownAxis":  (&Configuration{}).Matrix("tests").Axis("os", MatrixAxisValue{ID: "linux"}).Exclude(MatrixRule{"compiler": {"gcc"}}),
+			"RuleUnknownValue": (&Configuration{}).Matrix("tests").Axis("os", MatrixAxisValue{ID: "linux"}).Include(MatrixRule{"os": {"solaris"}}),
+		}
+		for name, m := range cases {
+			t.Run(name, func(t *testing.T) {
+				variants, err := m.Build()
+				assert(t, err != nil, "expected error")
+				assert(t, variants == nil)
+				assert(t, len(m.conf.Variants) == 0, "configuration is not modified")
+			})
+		}
+	})
+}
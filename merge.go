@@ -0,0 +1,387 @@
+package shrub
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// MergePolicy determines how Merge resolves definitions that conflict
+// between two configurations.
+type MergePolicy int
+
+const (
+	// MergeError causes Merge to fail, without modifying the
+	// configuration, if any definitions conflict.
+	MergeError MergePolicy = iota
+	// MergeOverride resolves conflicts in favor of the configuration
+	// being merged in.
+	MergeOverride
+	// MergeKeepFirst resolves conflicts in favor of the configuration
+	// being merged into.
+	MergeKeepFirst
+)
+
+// Validate checks that the policy is one of the defined policies.
+func (p MergePolicy) Validate() error {
+	switch p {
+	case MergeError, MergeOverride, MergeKeepFirst:
+		return nil
+	default:
+		return fmt.Errorf("'%d' is not a valid merge policy", p)
+	}
+}
+
+// Merge adds the project settings, modules, functions, tasks, task
+// groups and build variants of the other configuration to this one.
+//
+// Modules, functions, tasks and task groups are added by name. Defining
+// the same name in both configurations is only a conflict if the
+// definitions differ. Ignored file patterns are combined, and every
+// other project setting (including the pre, post and timeout commands)
+// is taken from whichever configuration sets it; settings that are set
+// differently in both configurations are conflicts. Build variants of
+// the same name are combined: task specs and display tasks are added by
+// name (the execution tasks of display tasks with the same name are
+// combined), expansions are added by key, tags and modules are
+// combined, and every other setting is taken from whichever variant
+// sets it. Task specs, expansions and settings that are set differently
+// in both variants are conflicts.
+//
+// The policy determines how conflicts are resolved. With MergeError,
+// Merge returns an error describing every conflict and leaves the
+// configuration unchanged.
+//
+// Everything added from the other configuration is copied (see Clone),
+// so later changes to either configuration do not affect the other.
+func (c *Configuration) Merge(other *Configuration, policy MergePolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	if other == nil {
+		return nil
+	}
+
+	m := &merger{dst: c, src: other.Clone(), policy: policy}
+	m.merge()
+	if policy == MergeError && len(m.conflicts) > 0 {
+		return errors.Join(m.conflicts...)
+	}
+
+	m.apply = true
+	m.merge()
+
+	return nil
+}
+
+// merger merges one configuration into another. It runs twice: first
+// to find conflicts without modifying anything, and then to apply the
+// changes.
+type merger struct {
+	dst       *Configuration
+	src       *Configuration
+	policy    MergePolicy
+	apply     bool
+	conflicts []error
+}
+
+// conflict records a conflict at the path, and reports whether it
+// should be resolved in favor of the other configuration.
+func (m *merger) conflict(path string) bool {
+	if !m.apply {
+		m.conflicts = append(m.conflicts, fmt.Errorf("%s: conflicting definitions", path))
+	}
+	return m.policy == MergeOverride
+}
+
+func (m *merger) merge() {
+	m.project()
+	m.modules()
+	m.functions()
+	m.tasks()
+	m.groups()
+	m.variants()
+}
+
+// projectMergedFields are the configuration fields that are combined
+// rather than taken from one configuration or the other.
+var projectMergedFields = map[string]bool{
+	"IgnoredFiles": true,
+	"Modules":      true,
+	"Functions":    true,
+	"Tasks":        true,
+	"Groups":       true,
+	"Variants":     true,
+}
+
+func (m *merger) project() {
+	if m.apply {
+		m.dst.IgnoredFiles = unionStrings(m.dst.IgnoredFiles, m.src.IgnoredFiles)
+	}
+
+	m.fields("", reflect.ValueOf(m.dst).Elem(), reflect.ValueOf(m.src).Elem(), projectMergedFields)
+}
+
+func (m *merger) modules() {
+	for _, mod := range m.src.Modules {
+		if mod == nil {
+			continue
+		}
+
+		idx := -1
+		for i, existing := range m.dst.Modules {
+			if existing != nil && existing.ModuleName == mod.ModuleName {
+				idx = i
+				break
+			}
+		}
+
+		switch {
+		case idx < 0:
+			if m.apply {
+				m.dst.Modules = append(m.dst.Modules, mod)
+			}
+		case sameDefinition(m.dst.Modules[idx], mod):
+		case m.conflict(fmt.Sprintf("modules[%s]", mod.ModuleName)) && m.apply:
+			m.dst.Modules[idx] = mod
+		}
+	}
+}
+
+func (m *merger) functions() {
+	for _, name := range sortedKeys(m.src.Functions) {
+		fn := m.src.Functions[name]
+		existing, ok := m.dst.Functions[name]
+		switch {
+		case !ok:
+		case sameDefinition(existing, fn):
+			continue
+		case !m.conflict(fmt.Sprintf("functions[%s]", name)):
+			continue
+		}
+
+		if m.apply {
+			if m.dst.Functions == nil {
+				m.dst.Functions = map[string]*CommandSequence{}
+			}
+			m.dst.Functions[name] = fn
+		}
+	}
+}
+
+func (m *merger) tasks() {
+	for _, t := range m.src.Tasks {
+		if t == nil {
+			continue
+		}
+
+		idx := -1
+		for i, existing := range m.dst.Tasks {
+			if existing != nil && existing.Name == t.Name {
+				idx = i
+				break
+			}
+		}
+
+		switch {
+		case idx < 0:
+			if m.apply {
+				m.dst.Tasks = append(m.dst.Tasks, t)
+			}
+		case sameDefinition(m.dst.Tasks[idx], t):
+		case m.conflict(fmt.Sprintf("tasks[%s]", t.Name)) && m.apply:
+			m.dst.Tasks[idx] = t
+		}
+	}
+}
+
+func (m *merger) groups() {
+	for _, g := range m.src.Groups {
+		if g == nil {
+			continue
+		}
+
+		idx := -1
+		for i, existing := range m.dst.Groups {
+			if existing != nil && existing.GroupName == g.GroupName {
+				idx = i
+				break
+			}
+		}
+
+		switch {
+		case idx < 0:
+			if m.apply {
+				m.dst.Groups = append(m.dst.Groups, g)
+			}
+		case sameDefinition(m.dst.Groups[idx], g):
+		case m.conflict(fmt.Sprintf("task_groups[%s]", g.GroupName)) && m.apply:
+			m.dst.Groups[idx] = g
+		}
+	}
+}
+
+func (m *merger) variants() {
+	for _, v := range m.src.Variants {
+		if v == nil {
+			continue
+		}
+
+		existing := m.dst.findVariant(v.BuildName)
+		if existing == nil {
+			if m.apply {
+				m.dst.Variants = append(m.dst.Variants, v)
+			}
+			continue
+		}
+
+		m.variant(existing, v)
+	}
+}
+
+// variantMergedFields are the variant fields that are combined rather
+// than taken from one variant or the other.
+var variantMergedFields = map[string]bool{
+	"BuildName":        true,
+	"TaskSpecs":        true,
+	"Expansions":       true,
+	"DisplayTaskSpecs": true,
+	"Tags":             true,
+	"Modules":          true,
+}
+
+func (m *merger) variant(dst, src *Variant) {
+	path := fmt.Sprintf("buildvariants[%s]", dst.BuildName)
+
+	for _, spec := range src.TaskSpecs {
+		idx := -1
+		for i := range dst.TaskSpecs {
+			if dst.TaskSpecs[i].Name == spec.Name {
+				idx = i
+				break
+			}
+		}
+
+		switch {
+		case idx < 0:
+			if m.apply {
+				dst.TaskSpecs = append(dst.TaskSpecs, spec)
+			}
+		case sameDefinition(dst.TaskSpecs[idx], spec):
+		case m.conflict(fmt.Sprintf("%s.tasks[%s]", path, spec.Name)) && m.apply:
+			dst.TaskSpecs[idx] = spec
+		}
+	}
+
+	for _, k := range sortedKeys(src.Expansions) {
+		val := src.Expansions[k]
+		existing, ok := dst.Expansions[k]
+		switch {
+		case !ok:
+		case reflect.DeepEqual(existing, val):
+			continue
+		case !m.conflict(fmt.Sprintf("%s.expansions[%s]", path, k)):
+			continue
+		}
+
+		if m.apply {
+			dst.Expansion(k, val)
+		}
+	}
+
+	for _, dt := range src.DisplayTaskSpecs {
+		if !m.apply {
+			continue
+		}
+
+		idx := -1
+		for i := range dst.DisplayTaskSpecs {
+			if dst.DisplayTaskSpecs[i].Name == dt.Name {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			dst.DisplayTaskSpecs = append(dst.DisplayTaskSpecs, DisplayTaskDefinition{
+				Name:       dt.Name,
+				Components: append([]string{}, dt.Components...),
+			})
+			continue
+		}
+		dst.DisplayTaskSpecs[idx].Components = unionStrings(dst.DisplayTaskSpecs[idx].Components, dt.Components)
+	}
+
+	if m.apply {
+		dst.Tags = unionStrings(dst.Tags, src.Tags)
+		dst.Modules = unionStrings(dst.Modules, src.Modules)
+	}
+
+	m.fields(path, reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem(), variantMergedFields)
+}
+
+// fields sets each exported field of dst, other than those skipped, to
+// the value of the field in src if the field is only set in src, or if
+// it is set differently in both and the conflict is resolved in favor
+// of src.
+func (m *merger) fields(path string, dv, sv reflect.Value, skip map[string]bool) {
+	for i := 0; i < dv.NumField(); i++ {
+		field := dv.Type().Field(i)
+		if skip[field.Name] || !field.IsExported() {
+			continue
+		}
+
+		df, sf := dv.Field(i), sv.Field(i)
+		switch {
+		case sf.IsZero():
+			continue
+		case df.IsZero():
+		case reflect.DeepEqual(df.Interface(), sf.Interface()):
+			continue
+		case !m.conflict(joinPath(path, strings.Split(field.Tag.Get("json"), ",")[0])):
+			continue
+		}
+
+		if m.apply {
+			df.Set(sf)
+		}
+	}
+}
+
+// sameDefinition reports whether the two values have the same JSON
+// representation.
+func sameDefinition(a, b interface{}) bool {
+	aj, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bj, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(aj, bj)
+}
+
+// unionStrings returns the elements of a followed by the elements of b
+// that are not in a.
+func unionStrings(a, b []string) []string {
+	out := a
+	for _, s := range b {
+		if !containsString(out, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,162 @@
+package shrub
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	cases := map[string]func(t *testing.T, conf, other *Configuration){
+		"Union": func(t *testing.T, conf, other *Configuration) {
+			conf.Function("setup").Command().Command("git.get_project").Param("directory", "src")
+			conf.Task("compile").Function("setup")
+			conf.Task("lint").Function("setup")
+			conf.Variant("ubuntu").DisplayName("Ubuntu").RunOn("ubuntu2204").SetTags("linux").
+				AddTasks("compile", "lint").Expansion("goos", "linux").
+				DisplayTasks(DisplayTaskDefinition{Name: "checks", Components: []string{"lint"}})
+
+			other.Function("setup").Command().Command("git.get_project").Param("directory", "src")
+			other.Function("upload").Command().Command("s3.put")
+			other.Task("compile").Function("setup")
+			other.Task("test").Function("setup", "upload")
+			other.TaskGroup("integration").Task("test")
+			other.Variant("ubuntu").SetTags("linux", "amd64").BatchTime(60).
+				AddTasks("test").Expansion("goos", "linux").Expansion("cgo", "0").
+				DisplayTasks(DisplayTaskDefinition{Name: "checks", Components: []string{"test"}})
+			other.Variant("windows").AddTasks("compile")
+
+			require(t, conf.Merge(other, MergeError) == nil)
+
+			assert(t, len(conf.Functions) == 2)
+			assert(t, len(conf.Tasks) == 3, "identical tasks are not duplicated")
+			assert(t, len(conf.Groups) == 1)
+			require(t, len(conf.Variants) == 2, "variants are unioned by name")
+
+			ubuntu := conf.Variants[0]
+			assert(t, ubuntu.BuildDisplayName == "Ubuntu")
+			assert(t, ubuntu.BatchTimeSecs == 60, "unset settings are taken from the other variant")
+			assert(t, strings.Join(ubuntu.Tags, ",") == "linux,amd64")
+			assert(t, len(ubuntu.TaskSpecs) == 3)
+			assert(t, ubuntu.Expansions["goos"] == "linux" && ubuntu.Expansions["cgo"] == "0")
+			require(t, len(ubuntu.DisplayTaskSpecs) == 1)
+			assert(t, strings.Join(ubuntu.DisplayTaskSpecs[0].Components, ",") == "lint,test")
+			assert(t, len(other.Variants[0].DisplayTaskSpecs[0].Components) == 1, "the other configuration is not modified")
+
+			assert(t, conf.Validate() == nil, errString(conf.Validate()))
+		},
+		"ConflictsError": func(t *testing.T, conf, other *Configuration) {
+			conf.Function("setup").Command().Command("git.get_project")
+			conf.Task("compile")
+			conf.Variant("ubuntu").RunOn("ubuntu2204").AddTasks("compile", "lint").Expansion("goos", "linux")
+
+			other.Function("setup").Command().Command("shell.exec")
+			other.Task("compile").Command(CmdExec{Binary: "make"})
+			other.Variant("ubuntu").RunOn("ubuntu2404").Expansion("goos", "plan9").
+				TaskSpec(TaskSpec{Name: "lint", Priority: 10})
+
+			before, err := conf.Marshal(JSON)
+			require(t, err == nil, errString(err))
+
+			err = conf.Merge(other, MergeError)
+			require(t, err != nil)
+			var joined interface{ Unwrap() []error }
+			require(t, errors.As(err, &joined))
+			assert(t, len(joined.Unwrap()) == 5, err.Error())
+			for _, path := range []string{
+				"functions[setup]",
+				"tasks[compile]",
+				"buildvariants[ubuntu].tasks[lint]",
+				"buildvariants[ubuntu].expansions[goos]",
+				"buildvariants[ubuntu].run_on",
+			} {
+				assert(t, strings.Contains(err.Error(), path+": conflicting definitions"), path, err.Error())
+			}
+
+			after, err := conf.Marshal(JSON)
+			require(t, err == nil, errString(err))
+			assert(t, string(before) == string(after), "configuration is unchanged")
+		},
+		"ConflictsOverride": func(t *testing.T, conf, other *Configuration) {
+			conf.Function("setup").Command().Command("git.get_project")
+			conf.Task("compile")
+			conf.Variant("ubuntu").DisplayName("Ubuntu").RunOn("ubuntu2204").AddTasks("compile", "lint").Expansion("goos", "linux")
+
+			other.Function("setup").Command().Command("shell.exec")
+			other.Task("compile").Command(CmdExec{Binary: "make"})
+			other.Variant("ubuntu").RunOn("ubuntu2404").Expansion("goos", "plan9").
+				TaskSpec(TaskSpec{Name: "lint", Priority: 10})
+
+			require(t, conf.Merge(other, MergeOverride) == nil)
+
+			assert(t, (*conf.Functions["setup"])[0].CommandName == "shell.exec")
+			assert(t, sameDefinition(conf.Task("compile"), other.Task("compile")))
+			assert(t, conf.Task("compile") != other.Task("compile"), "merged definitions are copied")
+			ubuntu := conf.Variants[0]
+			assert(t, ubuntu.DistroRunOn[0] == "ubuntu2404")
+			assert(t, ubuntu.Expansions["goos"] == "plan9")
+			assert(t, ubuntu.TaskSpecs[1].Name == "lint" && ubuntu.TaskSpecs[1].Priority == 10)
+			assert(t, ubuntu.BuildDisplayName == "Ubuntu", "unset settings do not override")
+		},
+		"ConflictsKeepFirst": func(t *testing.T, conf, other *Configuration) {
+			conf.Function("setup").Command().Command("git.get_project")
+			conf.Task("compile")
+			conf.Variant("ubuntu").RunOn("ubuntu2204").AddTasks("compile", "lint").Expansion("goos", "linux")
+
+			other.Function("setup").Command().Command("shell.exec")
+			other.Task("compile").Command(CmdExec{Binary: "make"})
+			other.Task("test")
+			other.Variant("ubuntu").RunOn("ubuntu2404").Expansion("goos", "plan9").
+				TaskSpec(TaskSpec{Name: "lint", Priority: 10})
+
+			require(t, conf.Merge(other, MergeKeepFirst) == nil)
+
+			assert(t, (*conf.Functions["setup"])[0].CommandName == "git.get_project")
+			assert(t, conf.Task("compile") != other.Task("compile"))
+			ubuntu := conf.Variants[0]
+			assert(t, ubuntu.DistroRunOn[0] == "ubuntu2204")
+			assert(t, ubuntu.Expansions["goos"] == "linux")
+			assert(t, ubuntu.TaskSpecs[1].Priority == 0)
+			assert(t, len(conf.Tasks) == 2, "non-conflicting definitions are still merged")
+		},
+		"ProjectSettings": func(t *testing.T, conf, other *Configuration) {
+			conf.SetCommandType("test").Ignore("*.md").Module("tools").Repo("tools.git").Branch("main")
+			conf.Post().Append(&CommandDefinition{FunctionName: "parse-results"})
+			other.SetCommandType("system").SetStepback(true).Ignore("*.md", "*.rst").
+				Module("docs").Repo("docs.git").Branch("main")
+			other.Module("tools").Repo("tools.git").Branch("main")
+			other.Post().Append(&CommandDefinition{FunctionName: "parse-results"})
+
+			err := conf.Merge(other, MergeError)
+			require(t, err != nil)
+			assert(t, err.Error() == "command_type: conflicting definitions", err.Error())
+
+			require(t, conf.Merge(other, MergeKeepFirst) == nil)
+			assert(t, conf.CommandType == "test")
+			assert(t, conf.Stepback != nil && *conf.Stepback, "unset settings are taken from the other configuration")
+			assert(t, strings.Join(conf.IgnoredFiles, ",") == "*.md,*.rst")
+			assert(t, len(conf.Modules) == 2, "identical modules are not duplicated")
+			assert(t, len(conf.PostCommands) == 1)
+		},
+		"Nil": func(t *testing.T, conf, _ *Configuration) {
+			conf.Task("compile")
+			conf.Task("lint")
+
+			assert(t, conf.Merge(nil, MergeError) == nil)
+			assert(t, len(conf.Tasks) == 2)
+		},
+		"InvalidPolicy": func(t *testing.T, conf, other *Configuration) {
+			conf.Task("compile")
+			other.Task("test")
+
+			assert(t, conf.Merge(other, MergePolicy(42)) != nil)
+			assert(t, len(conf.Tasks) == 1)
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			test(t, &Configuration{}, &Configuration{})
+		})
+	}
+}
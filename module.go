@@ -0,0 +1,19 @@
+package shrub
+
+// Module describes a repository that Evergreen checks out alongside the
+// project for the build variants that list it.
+type Module struct {
+	ModuleName string `json:"name" yaml:"name"`
+	Repository string `json:"repo" yaml:"repo"`
+	Owner      string `json:"owner,omitempty" yaml:"owner,omitempty"`
+	BranchName string `json:"branch" yaml:"branch"`
+	PathPrefix string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	AutoUpdate bool   `json:"auto_update,omitempty" yaml:"auto_update,omitempty"`
+}
+
+func (m *Module) Name(id string) *Module         { m.ModuleName = id; return m }
+func (m *Module) Repo(repo string) *Module       { m.Repository = repo; return m }
+func (m *Module) SetOwner(owner string) *Module  { m.Owner = owner; return m }
+func (m *Module) Branch(branch string) *Module   { m.BranchName = branch; return m }
+func (m *Module) Prefix(prefix string) *Module   { m.PathPrefix = prefix; return m }
+func (m *Module) SetAutoUpdate(val bool) *Module { m.AutoUpdate = val; return m }
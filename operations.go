@@ -47,8 +47,19 @@ type CmdExec struct {
 	WorkingDirectory              string            `json:"working_dir,omitempty" yaml:"working_dir,omitempty"`
 }
 
-func (c CmdExec) Name() string    { return "subprocess.exec" }
-func (c CmdExec) Validate() error { return nil }
+func (c CmdExec) Name() string { return "subprocess.exec" }
+func (c CmdExec) Validate() error {
+	switch {
+	case c.Binary == "" && c.Command == "":
+		return errors.New("must specify either a binary or a command")
+	case c.Binary != "" && c.Command != "":
+		return errors.New("cannot specify both a binary and a command")
+	case c.Command != "" && len(c.Args) > 0:
+		return errors.New("cannot specify args with a command")
+	default:
+		return nil
+	}
+}
 func (c CmdExec) Resolve() *CommandDefinition {
 	return &CommandDefinition{
 		CommandName: c.Name(),
@@ -62,7 +73,7 @@ type CmdExecShell struct {
 	Shell                         string            `json:"shell,omitempty" yaml:"shell,omitempty"`
 	Env                           map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
 	AddExpansionsToEnv            map[string]string `json:"add_expansions_to_env,omitempty" yaml:"add_expansions_to_env,omitempty"`
-	IncludeExpansionsInEnv        []string          `json:"include_expansions_in_env,omitempty" yaml:"include_expansions_inenv,omitempty"`
+	IncludeExpansionsInEnv        []string          `json:"include_expansions_in_env,omitempty" yaml:"include_expansions_in_env,omitempty"`
 	AddToPath                     []string          `json:"add_to_path,omitempty" yaml:"add_to_path,omitempty"`
 	ContinueOnError               bool              `json:"continue_on_err,omitempty" yaml:"continue_on_err,omitempty"`
 	Background                    bool              `json:"background,omitempty" yaml:"background,omitempty"`
@@ -74,8 +85,13 @@ type CmdExecShell struct {
 	WorkingDirectory              string            `json:"working_dir,omitempty" yaml:"working_dir,omitempty"`
 }
 
-func (c CmdExecShell) Name() string    { return "shell.exec" }
-func (c CmdExecShell) Validate() error { return nil }
+func (c CmdExecShell) Name() string { return "shell.exec" }
+func (c CmdExecShell) Validate() error {
+	if c.Script == "" {
+		return errors.New("must specify a script")
+	}
+	return nil
+}
 func (c CmdExecShell) Resolve() *CommandDefinition {
 	return &CommandDefinition{
 		CommandName: c.Name(),
@@ -109,10 +125,18 @@ type CmdS3Put struct {
 func (c CmdS3Put) Name() string { return "s3.put" }
 func (c CmdS3Put) Validate() error {
 	switch {
-	case c.AWSKey == "", c.AWSSecret == "":
+	case !hasS3Credentials(c.AWSKey, c.AWSSecret, c.RoleARN):
 		return errors.New("must specify aws credentials")
 	case c.LocalFile == "" && len(c.LocalFilesIncludeFilter) == 0:
 		return errors.New("must specify a local file to upload")
+	case c.LocalFile != "" && len(c.LocalFilesIncludeFilter) > 0:
+		return errors.New("cannot specify both a local file and a local files include filter")
+	case c.Bucket == "":
+		return errors.New("must specify a bucket")
+	case c.RemoteFile == "":
+		return errors.New("must specify a remote file")
+	case c.ContentType == "":
+		return errors.New("must specify a content type")
 	default:
 		return nil
 	}
@@ -125,6 +149,12 @@ func (c CmdS3Put) Resolve() *CommandDefinition {
 }
 func s3PutFactory() Command { return CmdS3Put{} }
 
+// hasS3Credentials reports whether the S3 commands' credentials are
+// specified, either as a key and secret or as a role to assume.
+func hasS3Credentials(key, secret, roleARN string) bool {
+	return (key != "" && secret != "") || roleARN != ""
+}
+
 type CmdS3Get struct {
 	AWSKey                string   `json:"aws_key" yaml:"aws_key"`
 	AWSSecret             string   `json:"aws_secret" yaml:"aws_secret"`
@@ -140,8 +170,23 @@ type CmdS3Get struct {
 	RequireChecksumSha256 string   `json:"require_checksum_sha256,omitempty" yaml:"require_checksum_sha256,omitempty"`
 }
 
-func (c CmdS3Get) Name() string    { return "s3.get" }
-func (c CmdS3Get) Validate() error { return nil }
+func (c CmdS3Get) Name() string { return "s3.get" }
+func (c CmdS3Get) Validate() error {
+	switch {
+	case !hasS3Credentials(c.AWSKey, c.AWSSecret, c.RoleARN):
+		return errors.New("must specify aws credentials")
+	case c.Bucket == "":
+		return errors.New("must specify a bucket")
+	case c.RemoteFile == "":
+		return errors.New("must specify a remote file")
+	case c.LocalFile == "" && c.ExtractTo == "":
+		return errors.New("must specify either a local file or a directory to extract to")
+	case c.LocalFile != "" && c.ExtractTo != "":
+		return errors.New("cannot specify both a local file and a directory to extract to")
+	default:
+		return nil
+	}
+}
 func (c CmdS3Get) Resolve() *CommandDefinition {
 	return &CommandDefinition{
 		CommandName: c.Name(),
@@ -151,29 +196,80 @@ func (c CmdS3Get) Resolve() *CommandDefinition {
 func s3GetFactory() Command { return CmdS3Get{} }
 
 type CmdS3Copy struct {
-	AWSKey          string `json:"aws_key" yaml:"aws_key"`
-	AWSSecret       string `json:"aws_secret" yaml:"aws_secret"`
-	AWSSessionToken string `json:"aws_session_token" yaml:"aws_session_token"`
-	Files           []struct {
-		Source struct {
-			Bucket string `json:"bucket" yaml:"bucket"`
-			Path   string `json:"path" yaml:"path"`
-			Region string `json:"region,omitempty" yaml:"region,omitempty"`
-		} `json:"source" yaml:"source"`
-		Destination struct {
-			Bucket string `json:"bucket" yaml:"bucket"`
-			Path   string `json:"path" yaml:"path"`
-			Region string `json:"region,omitempty" yaml:"region,omitempty"`
-		} `json:"destination" yaml:"destination"`
-		DisplayName   string   `json:"display_name,omitempty" yaml:"display_name,omitempty"`
-		Permissions   string   `json:"permissions,omitempty" yaml:"permissions,omitempty"`
-		BuildVariants []string `json:"build_variants,omitempty" yaml:"build_variants,omitempty"`
-		Optional      bool     `json:"optional,omitempty" yaml:"optional,omitempty"`
-	} `json:"s3_copy_files" yaml:"s3_copy_files"`
-}
-
-func (c CmdS3Copy) Name() string    { return "s3Copy.copy" }
-func (c CmdS3Copy) Validate() error { return nil }
+	AWSKey          string       `json:"aws_key" yaml:"aws_key"`
+	AWSSecret       string       `json:"aws_secret" yaml:"aws_secret"`
+	AWSSessionToken string       `json:"aws_session_token" yaml:"aws_session_token"`
+	RoleARN         string       `json:"role_arn,omitempty" yaml:"role_arn,omitempty"`
+	Files           []S3CopyFile `json:"s3_copy_files" yaml:"s3_copy_files"`
+}
+
+// S3CopyFile describes a single file copied by s3Copy.copy.
+type S3CopyFile struct {
+	Source        S3Location `json:"source" yaml:"source"`
+	Destination   S3Location `json:"destination" yaml:"destination"`
+	DisplayName   string     `json:"display_name,omitempty" yaml:"display_name,omitempty"`
+	Permissions   string     `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+	BuildVariants []string   `json:"build_variants,omitempty" yaml:"build_variants,omitempty"`
+	Optional      bool       `json:"optional,omitempty" yaml:"optional,omitempty"`
+}
+
+// S3Location identifies a file in an S3 bucket.
+type S3Location struct {
+	Bucket string `json:"bucket" yaml:"bucket"`
+	Path   string `json:"path" yaml:"path"`
+	Region string `json:"region,omitempty" yaml:"region,omitempty"`
+}
+
+func (l S3Location) Validate() error {
+	switch {
+	case l.Bucket == "":
+		return errors.New("must specify a bucket")
+	case l.Path == "":
+		return errors.New("must specify a path")
+	default:
+		return nil
+	}
+}
+
+func (f S3CopyFile) Validate() error {
+	if err := f.Source.Validate(); err != nil {
+		return fmt.Errorf("invalid source: %w", err)
+	}
+	if err := f.Destination.Validate(); err != nil {
+		return fmt.Errorf("invalid destination: %w", err)
+	}
+	return nil
+}
+
+// AddFile adds a file to copy from the source to the destination.
+func (c *CmdS3Copy) AddFile(src, dst S3Location) *CmdS3Copy {
+	return c.AddFiles(S3CopyFile{Source: src, Destination: dst})
+}
+
+// AddFiles adds files to copy, for files that need more than a source
+// and destination.
+func (c *CmdS3Copy) AddFiles(files ...S3CopyFile) *CmdS3Copy {
+	c.Files = append(c.Files, files...)
+	return c
+}
+
+func (c CmdS3Copy) Name() string { return "s3Copy.copy" }
+func (c CmdS3Copy) Validate() error {
+	switch {
+	case !hasS3Credentials(c.AWSKey, c.AWSSecret, c.RoleARN):
+		return errors.New("must specify aws credentials")
+	case len(c.Files) == 0:
+		return errors.New("must specify at least one file to copy")
+	}
+
+	for idx, file := range c.Files {
+		if err := file.Validate(); err != nil {
+			return fmt.Errorf("file %d: %w", idx, err)
+		}
+	}
+
+	return nil
+}
 func (c CmdS3Copy) Resolve() *CommandDefinition {
 	return &CommandDefinition{
 		CommandName: c.Name(),
@@ -187,8 +283,13 @@ type CmdS3Push struct {
 	MaxRetries    int    `json:"max_retries,omitempty" yaml:"max_retries,omitempty"`
 }
 
-func (c CmdS3Push) Name() string    { return "s3.push" }
-func (c CmdS3Push) Validate() error { return nil }
+func (c CmdS3Push) Name() string { return "s3.push" }
+func (c CmdS3Push) Validate() error {
+	if c.MaxRetries < 0 {
+		return errors.New("max retries cannot be negative")
+	}
+	return nil
+}
 func (c CmdS3Push) Resolve() *CommandDefinition {
 	return &CommandDefinition{
 		CommandName: c.Name(),
@@ -206,8 +307,17 @@ type CmdS3Pull struct {
 	FromBuildVariant string `json:"from_build_variant,omitempty" yaml:"from_build_variant,omitempty"`
 }
 
-func (c CmdS3Pull) Name() string    { return "s3.pull" }
-func (c CmdS3Pull) Validate() error { return nil }
+func (c CmdS3Pull) Name() string { return "s3.pull" }
+func (c CmdS3Pull) Validate() error {
+	switch {
+	case c.Task == "":
+		return errors.New("must specify the task to pull from")
+	case c.MaxRetries < 0:
+		return errors.New("max retries cannot be negative")
+	default:
+		return nil
+	}
+}
 func (c CmdS3Pull) Resolve() *CommandDefinition {
 	return &CommandDefinition{
 		CommandName: c.Name(),
@@ -221,8 +331,13 @@ type CmdSetExpansions struct {
 	IgnoreMissingFile string `json:"ignore_missing_file" yaml:"ignore_missing_file"`
 }
 
-func (c CmdSetExpansions) Name() string    { return "downstream_expansions.set" }
-func (c CmdSetExpansions) Validate() error { return nil }
+func (c CmdSetExpansions) Name() string { return "downstream_expansions.set" }
+func (c CmdSetExpansions) Validate() error {
+	if c.YAMLFile == "" {
+		return errors.New("must specify a file")
+	}
+	return nil
+}
 func (c CmdSetExpansions) Resolve() *CommandDefinition {
 	return &CommandDefinition{
 		CommandName: c.Name(),
@@ -242,8 +357,13 @@ type CmdGetProject struct {
 	CommitterEmail    string            `json:"committer_email,omitempty" yaml:"committer_email,omitempty"`
 }
 
-func (c CmdGetProject) Name() string    { return "git.get_project" }
-func (c CmdGetProject) Validate() error { return nil }
+func (c CmdGetProject) Name() string { return "git.get_project" }
+func (c CmdGetProject) Validate() error {
+	if c.Directory == "" {
+		return errors.New("must specify a directory")
+	}
+	return nil
+}
 func (c CmdGetProject) Resolve() *CommandDefinition {
 	return &CommandDefinition{
 		CommandName: c.Name(),
@@ -256,8 +376,13 @@ type CmdResultsJSON struct {
 	File string `json:"file_location" yaml:"file_location"`
 }
 
-func (c CmdResultsJSON) Name() string    { return "attach.results" }
-func (c CmdResultsJSON) Validate() error { return nil }
+func (c CmdResultsJSON) Name() string { return "attach.results" }
+func (c CmdResultsJSON) Validate() error {
+	if c.File == "" {
+		return errors.New("must specify a results file")
+	}
+	return nil
+}
 func (c CmdResultsJSON) Resolve() *CommandDefinition {
 	return &CommandDefinition{
 		CommandName: c.Name(),
@@ -271,8 +396,13 @@ type CmdResultsXunit struct {
 	Files []string `json:"files,omitempty" yaml:"files,omitempty"`
 }
 
-func (c CmdResultsXunit) Name() string    { return "attach.xunit_results" }
-func (c CmdResultsXunit) Validate() error { return nil }
+func (c CmdResultsXunit) Name() string { return "attach.xunit_results" }
+func (c CmdResultsXunit) Validate() error {
+	if c.File == "" && len(c.Files) == 0 {
+		return errors.New("must specify at least one results file")
+	}
+	return nil
+}
 func (c CmdResultsXunit) Resolve() *CommandDefinition {
 	return &CommandDefinition{
 		CommandName: c.Name(),
@@ -289,6 +419,9 @@ func (c CmdResultsGoTest) Name() string {
 	return "gotest.parse_files"
 }
 func (c CmdResultsGoTest) Validate() error {
+	if len(c.Files) == 0 {
+		return errors.New("must specify at least one results file")
+	}
 	return nil
 }
 func (c CmdResultsGoTest) Resolve() *CommandDefinition {
@@ -348,8 +481,23 @@ type CmdArchiveCreate struct {
 	ExcludeFiles []string      `json:"exclude_files,omitempty" yaml:"exclude_files,omitempty"`
 }
 
-func (c CmdArchiveCreate) Name() string    { return c.Format.createCmdName() }
-func (c CmdArchiveCreate) Validate() error { return c.Format.Validate() }
+func (c CmdArchiveCreate) Name() string { return c.Format.createCmdName() }
+func (c CmdArchiveCreate) Validate() error {
+	if err := c.Format.Validate(); err != nil {
+		return err
+	}
+
+	switch {
+	case c.Target == "":
+		return errors.New("must specify a target archive")
+	case c.SourceDir == "":
+		return errors.New("must specify a source directory")
+	case len(c.Include) == 0:
+		return errors.New("must specify at least one file to include")
+	default:
+		return nil
+	}
+}
 func (c CmdArchiveCreate) Resolve() *CommandDefinition {
 	return &CommandDefinition{
 		CommandName: c.Name(),
@@ -371,8 +519,14 @@ func (c CmdArchiveExtract) Validate() error {
 		return err
 	}
 
-	return nil
-
+	switch {
+	case c.ArchivePath == "":
+		return errors.New("must specify an archive path")
+	case c.TargetDirectory == "":
+		return errors.New("must specify a destination directory")
+	default:
+		return nil
+	}
 }
 func (c CmdArchiveExtract) Resolve() *CommandDefinition {
 	return &CommandDefinition{
@@ -393,8 +547,13 @@ type CmdAttachArtifacts struct {
 	Optional bool     `json:"optional,omitempty" yaml:"optional,omitempty"`
 }
 
-func (c CmdAttachArtifacts) Name() string    { return "attach.artifacts" }
-func (c CmdAttachArtifacts) Validate() error { return nil }
+func (c CmdAttachArtifacts) Name() string { return "attach.artifacts" }
+func (c CmdAttachArtifacts) Validate() error {
+	if len(c.Files) == 0 {
+		return errors.New("must specify at least one artifacts file")
+	}
+	return nil
+}
 func (c CmdAttachArtifacts) Resolve() *CommandDefinition {
 	return &CommandDefinition{
 		CommandName: c.Name(),
@@ -457,8 +616,46 @@ type HostCreateDockerRegistrySettings struct {
 	Password string `json:"registry_password,omitempty" yaml:"registry_password,omitempty"`
 }
 
-func (c CmdHostCreate) Name() string    { return "host.create" }
-func (c CmdHostCreate) Validate() error { return nil }
+func (c CmdHostCreate) Name() string { return "host.create" }
+func (c CmdHostCreate) Validate() error {
+	switch c.Scope {
+	case "", "task", "build":
+	default:
+		return fmt.Errorf("'%s' is not a valid scope, must be 'task' or 'build'", c.Scope)
+	}
+
+	switch {
+	case c.SetupTimeoutSecs < 0, c.TeardownTimeoutSecs < 0:
+		return errors.New("timeouts cannot be negative")
+	case c.Retries < 0:
+		return errors.New("retries cannot be negative")
+	case c.File != "":
+		// the remaining settings are read from the file at runtime
+		return nil
+	}
+
+	switch c.CloudProvider {
+	case "", "ec2":
+		switch {
+		case c.Distro == "" && c.AMI == "":
+			return errors.New("must specify either a distro or an AMI for ec2 hosts")
+		case c.Distro != "" && c.AMI != "":
+			return errors.New("cannot specify both a distro and an AMI for ec2 hosts")
+		case c.AMI != "" && c.InstanceType == "":
+			return errors.New("must specify an instance type when specifying an AMI")
+		case c.AMI != "" && len(c.SecurityGroups) == 0:
+			return errors.New("must specify security groups when specifying an AMI")
+		}
+	case "docker":
+		if c.Image == "" {
+			return errors.New("must specify an image for docker hosts")
+		}
+	default:
+		return fmt.Errorf("'%s' is not a valid provider, must be 'ec2' or 'docker'", c.CloudProvider)
+	}
+
+	return nil
+}
 func (c CmdHostCreate) Resolve() *CommandDefinition {
 	return &CommandDefinition{
 		CommandName: c.Name(),
@@ -476,8 +673,17 @@ type CmdHostList struct {
 	NumHosts    string `json:"num_hosts,omitempty" yaml:"num_hosts,omitempty"`
 }
 
-func (c CmdHostList) Name() string    { return "host.list" }
-func (c CmdHostList) Validate() error { return nil }
+func (c CmdHostList) Name() string { return "host.list" }
+func (c CmdHostList) Validate() error {
+	switch {
+	case c.Wait && c.NumHosts == "":
+		return errors.New("must specify the number of hosts to wait for")
+	case c.TimeoutSecs < 0:
+		return errors.New("timeout cannot be negative")
+	default:
+		return nil
+	}
+}
 func (c CmdHostList) Resolve() *CommandDefinition {
 	return &CommandDefinition{
 		CommandName: c.Name(),
@@ -500,8 +706,15 @@ type ExpansionUpdateParams struct {
 	Redact bool   `json:"redact,omitempty" yaml:"redact,omitempty"`
 }
 
-func (c CmdExpansionsUpdate) Name() string    { return "expansions.update" }
-func (c CmdExpansionsUpdate) Validate() error { return nil }
+func (c CmdExpansionsUpdate) Name() string { return "expansions.update" }
+func (c CmdExpansionsUpdate) Validate() error {
+	for idx, update := range c.Updates {
+		if update.Key == "" {
+			return fmt.Errorf("update %d must specify a key", idx)
+		}
+	}
+	return nil
+}
 func (c CmdExpansionsUpdate) Resolve() *CommandDefinition {
 	return &CommandDefinition{
 		CommandName: c.Name(),
@@ -516,8 +729,13 @@ type CmdExpansionsWrite struct {
 	Redacted bool   `json:"redacted,omitempty" yaml:"redacted,omitempty"`
 }
 
-func (c CmdExpansionsWrite) Name() string    { return "expansions.write" }
-func (c CmdExpansionsWrite) Validate() error { return nil }
+func (c CmdExpansionsWrite) Name() string { return "expansions.write" }
+func (c CmdExpansionsWrite) Validate() error {
+	if c.File == "" {
+		return errors.New("must specify a file")
+	}
+	return nil
+}
 func (c CmdExpansionsWrite) Resolve() *CommandDefinition {
 	return &CommandDefinition{
 		CommandName: c.Name(),
@@ -532,8 +750,17 @@ type CmdJSONSend struct {
 	DataName string `json:"name" yaml:"name"`
 }
 
-func (c CmdJSONSend) Name() string    { return "json.send" }
-func (c CmdJSONSend) Validate() error { return nil }
+func (c CmdJSONSend) Name() string { return "json.send" }
+func (c CmdJSONSend) Validate() error {
+	switch {
+	case c.File == "":
+		return errors.New("must specify a file")
+	case c.DataName == "":
+		return errors.New("must specify a name for the data")
+	default:
+		return nil
+	}
+}
 func (c CmdJSONSend) Resolve() *CommandDefinition {
 	return &CommandDefinition{
 		CommandName: c.Name(),
@@ -551,8 +778,21 @@ type CmdPapertrailTrace struct {
 	Filenames []string `json:"filenames,omitempty" yaml:"filenames,omitempty"`
 }
 
-func (c CmdPapertrailTrace) Name() string    { return "papertrail.trace" }
-func (c CmdPapertrailTrace) Validate() error { return nil }
+func (c CmdPapertrailTrace) Name() string { return "papertrail.trace" }
+func (c CmdPapertrailTrace) Validate() error {
+	switch {
+	case c.KeyID == "", c.SecretKey == "":
+		return errors.New("must specify papertrail credentials")
+	case c.Product == "":
+		return errors.New("must specify a product")
+	case c.Version == "":
+		return errors.New("must specify a version")
+	case len(c.Filenames) == 0:
+		return errors.New("must specify at least one file to trace")
+	default:
+		return nil
+	}
+}
 func (c CmdPapertrailTrace) Resolve() *CommandDefinition {
 	return &CommandDefinition{
 		CommandName: c.Name(),
@@ -571,8 +811,17 @@ type CmdPerfSend struct {
 	Prefix    string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
 }
 
-func (c CmdPerfSend) Name() string    { return "perf.send" }
-func (c CmdPerfSend) Validate() error { return nil }
+func (c CmdPerfSend) Name() string { return "perf.send" }
+func (c CmdPerfSend) Validate() error {
+	switch {
+	case c.File == "":
+		return errors.New("must specify a file")
+	case c.Bucket != "" && (c.AWSKey == "" || c.AWSSecret == ""):
+		return errors.New("must specify aws credentials when specifying a bucket")
+	default:
+		return nil
+	}
+}
 func (c CmdPerfSend) Resolve() *CommandDefinition {
 	return &CommandDefinition{
 		CommandName: c.Name(),
@@ -587,8 +836,17 @@ type CmdTimeoutUpdate struct {
 	ExecTimeoutSecs int `json:"exec_timeout_secs,omitempty" yaml:"exec_timeout_secs,omitempty"`
 }
 
-func (c CmdTimeoutUpdate) Name() string    { return "timeout.update" }
-func (c CmdTimeoutUpdate) Validate() error { return nil }
+func (c CmdTimeoutUpdate) Name() string { return "timeout.update" }
+func (c CmdTimeoutUpdate) Validate() error {
+	switch {
+	case c.TimeoutSecs == 0 && c.ExecTimeoutSecs == 0:
+		return errors.New("must specify at least one timeout")
+	case c.TimeoutSecs < 0, c.ExecTimeoutSecs < 0:
+		return errors.New("timeouts cannot be negative")
+	default:
+		return nil
+	}
+}
 func (c CmdTimeoutUpdate) Resolve() *CommandDefinition {
 	return &CommandDefinition{
 		CommandName: c.Name(),
@@ -606,8 +864,17 @@ type CmdGitHubGenerateToken struct {
 	Permissions *github.InstallationPermissions `json:"permissions,omitempty" yaml:"permissions,omitempty"`
 }
 
-func (c CmdGitHubGenerateToken) Name() string    { return "github.generate_token" }
-func (c CmdGitHubGenerateToken) Validate() error { return nil }
+func (c CmdGitHubGenerateToken) Name() string { return "github.generate_token" }
+func (c CmdGitHubGenerateToken) Validate() error {
+	switch {
+	case c.ExpansionName == "":
+		return errors.New("must specify an expansion name")
+	case (c.Owner == "") != (c.Repo == ""):
+		return errors.New("must specify both the owner and the repo or neither")
+	default:
+		return nil
+	}
+}
 func (c CmdGitHubGenerateToken) Resolve() *CommandDefinition {
 	return &CommandDefinition{
 		CommandName: c.Name(),
@@ -616,6 +883,26 @@ func (c CmdGitHubGenerateToken) Resolve() *CommandDefinition {
 }
 func githubGenerateTokenFactory() Command { return CmdGitHubGenerateToken{} }
 
+type CmdGenerateTasks struct {
+	Files    []string `json:"files" yaml:"files"`
+	Optional bool     `json:"optional,omitempty" yaml:"optional,omitempty"`
+}
+
+func (c CmdGenerateTasks) Name() string { return "generate.tasks" }
+func (c CmdGenerateTasks) Validate() error {
+	if len(c.Files) == 0 {
+		return errors.New("must specify at least one file to generate tasks from")
+	}
+	return nil
+}
+func (c CmdGenerateTasks) Resolve() *CommandDefinition {
+	return &CommandDefinition{
+		CommandName: c.Name(),
+		Params:      exportCmd(c),
+	}
+}
+func generateTasksFactory() Command { return CmdGenerateTasks{} }
+
 type CmdTestSelectionGet struct {
 	OutputFile string   `json:"output_file,omitempty" yaml:"output_file,omitempty"`
 	TestsFile  string   `json:"tests_file,omitempty" yaml:"tests_file,omitempty"`
@@ -624,8 +911,13 @@ type CmdTestSelectionGet struct {
 	Strategies string   `json:"strategies,omitempty" yaml:"strategies,omitempty"`
 }
 
-func (c CmdTestSelectionGet) Name() string    { return "test_selection.get" }
-func (c CmdTestSelectionGet) Validate() error { return nil }
+func (c CmdTestSelectionGet) Name() string { return "test_selection.get" }
+func (c CmdTestSelectionGet) Validate() error {
+	if c.OutputFile == "" {
+		return errors.New("must specify an output file")
+	}
+	return nil
+}
 func (c CmdTestSelectionGet) Resolve() *CommandDefinition {
 	return &CommandDefinition{
 		CommandName: c.Name(),
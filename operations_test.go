@@ -1,41 +1,44 @@
 package shrub
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
 	"testing"
 )
 
 func TestWellformedOperations(t *testing.T) {
 	cases := map[string]Command{
-		"subprocess.exec":           CmdExec{},
-		"shell.exec":                CmdExecShell{},
-		"downstream_expansions.set": CmdSetExpansions{},
-		"s3Copy.copy":               CmdS3Copy{},
-		"s3.get":                    CmdS3Get{},
-		"s3.put":                    CmdS3Put{AWSKey: "foo", AWSSecret: "bar", LocalFile: "baz"},
+		"subprocess.exec":           CmdExec{Binary: "make"},
+		"shell.exec":                CmdExecShell{Script: "make"},
+		"downstream_expansions.set": CmdSetExpansions{YAMLFile: "expansions.yml"},
+		"s3Copy.copy":               validS3Copy(),
+		"s3.get":                    CmdS3Get{AWSKey: "foo", AWSSecret: "bar", Bucket: "b", RemoteFile: "r", LocalFile: "baz"},
+		"s3.put":                    CmdS3Put{AWSKey: "foo", AWSSecret: "bar", LocalFile: "baz", Bucket: "b", RemoteFile: "r", ContentType: "text/plain"},
 		"s3.push":                   CmdS3Push{},
-		"s3.pull":                   CmdS3Pull{},
-		"git.get_project":           CmdGetProject{},
-		"attach.artifacts":          CmdAttachArtifacts{},
-		"attach.results":            CmdResultsJSON{},
-		"attach.xunit_results":      CmdResultsXunit{},
-		"gotest.parse_files":        CmdResultsGoTest{},
-		"archive.zip_pack":          CmdArchiveCreate{Format: ZIP},
-		"archive.targz_pack":        CmdArchiveCreate{Format: TARBALL},
-		"archive.zip_extract":       CmdArchiveExtract{Format: ZIP},
-		"archive.targz_extract":     CmdArchiveExtract{Format: TARBALL},
-		"archive.auto_extract":      CmdArchiveExtract{Format: ArchiveFormat("auto")},
-		"host.create":               CmdHostCreate{},
+		"s3.pull":                   CmdS3Pull{Task: "compile"},
+		"git.get_project":           CmdGetProject{Directory: "src"},
+		"attach.artifacts":          CmdAttachArtifacts{Files: []string{"artifacts.json"}},
+		"attach.results":            CmdResultsJSON{File: "results.json"},
+		"attach.xunit_results":      CmdResultsXunit{File: "junit.xml"},
+		"gotest.parse_files":        CmdResultsGoTest{Files: []string{"*.suite"}},
+		"archive.zip_pack":          CmdArchiveCreate{Format: ZIP, Target: "out.zip", SourceDir: "dist", Include: []string{"*"}},
+		"archive.targz_pack":        CmdArchiveCreate{Format: TARBALL, Target: "out.tgz", SourceDir: "dist", Include: []string{"*"}},
+		"archive.zip_extract":       CmdArchiveExtract{Format: ZIP, ArchivePath: "in.zip", TargetDirectory: "out"},
+		"archive.targz_extract":     CmdArchiveExtract{Format: TARBALL, ArchivePath: "in.tgz", TargetDirectory: "out"},
+		"archive.auto_extract":      CmdArchiveExtract{Format: ArchiveFormat("auto"), ArchivePath: "in", TargetDirectory: "out"},
+		"host.create":               CmdHostCreate{Distro: "ubuntu"},
 		"host.list":                 CmdHostList{},
 		"expansions.update":         CmdExpansionsUpdate{},
-		"expansions.write":          CmdExpansionsWrite{},
-		"json.send":                 CmdJSONSend{},
-		"papertrail.trace":          CmdPapertrailTrace{},
-		"perf.send":                 CmdPerfSend{},
-		"timeout.update":            CmdTimeoutUpdate{},
-		"github.generate_token":     CmdGitHubGenerateToken{},
-		"test_selection.get":        CmdTestSelectionGet{},
+		"expansions.write":          CmdExpansionsWrite{File: "expansions.yml"},
+		"json.send":                 CmdJSONSend{File: "data.json", DataName: "data"},
+		"papertrail.trace":          CmdPapertrailTrace{KeyID: "foo", SecretKey: "bar", Product: "shrub", Version: "1.0", Filenames: []string{"shrub.tgz"}},
+		"perf.send":                 CmdPerfSend{File: "perf.json"},
+		"timeout.update":            CmdTimeoutUpdate{TimeoutSecs: 60},
+		"github.generate_token":     CmdGitHubGenerateToken{ExpansionName: "token"},
+		"test_selection.get":        CmdTestSelectionGet{OutputFile: "tests.json"},
+		"generate.tasks":            CmdGenerateTasks{Files: []string{"generated.json"}},
 	}
 
 	for name, cmd := range cases {
@@ -71,7 +74,8 @@ func TestPoorlyFormedOperations(t *testing.T) {
 		"s3put.nosecret":      CmdS3Put{AWSKey: "foo", LocalFile: "baz"},
 		"s3put.nokey":         CmdS3Put{AWSSecret: "bar", LocalFile: "baz"},
 		"archive.create_auto": CmdArchiveCreate{Format: ArchiveFormat("auto")},
-		"archive.invalid":     CmdArchiveExtract{Format: ArchiveFormat("bleh")},
+		"archive.invalid":     CmdArchiveExtract{Format: ArchiveFormat("bleh"), ArchivePath: "in", TargetDirectory: "out"},
+		"generate.nofiles":    CmdGenerateTasks{},
 	}
 
 	for name, cmd := range cases {
@@ -93,3 +97,137 @@ func TestPoorlyFormedOperations(t *testing.T) {
 		assert(t, res == nil)
 	})
 }
+
+func validS3Copy() CmdS3Copy {
+	cmd := &CmdS3Copy{AWSKey: "foo", AWSSecret: "bar"}
+	return *cmd.AddFile(S3Location{Bucket: "src", Path: "a"}, S3Location{Bucket: "dst", Path: "b"})
+}
+
+func TestCommandValidation(t *testing.T) {
+	cases := map[string]struct {
+		cmd   Command
+		valid bool
+	}{
+		"exec.binary":             {cmd: CmdExec{Binary: "make", Args: []string{"test"}}, valid: true},
+		"exec.command":            {cmd: CmdExec{Command: "make test"}, valid: true},
+		"exec.neither":            {cmd: CmdExec{Args: []string{"test"}}},
+		"exec.both":               {cmd: CmdExec{Binary: "make", Command: "make test"}},
+		"exec.commandargs":        {cmd: CmdExec{Command: "make", Args: []string{"test"}}},
+		"shell.script":            {cmd: CmdExecShell{Script: "make"}, valid: true},
+		"shell.noscript":          {cmd: CmdExecShell{Shell: "bash"}},
+		"s3put.role":              {cmd: CmdS3Put{RoleARN: "role", LocalFile: "baz", Bucket: "b", RemoteFile: "r", ContentType: "text/plain"}, valid: true},
+		"s3put.filter":            {cmd: CmdS3Put{RoleARN: "role", LocalFilesIncludeFilter: []string{"*.tgz"}, Bucket: "b", RemoteFile: "r", ContentType: "text/plain"}, valid: true},
+		"s3put.fileandfilter":     {cmd: CmdS3Put{RoleARN: "role", LocalFile: "baz", LocalFilesIncludeFilter: []string{"*.tgz"}, Bucket: "b", RemoteFile: "r", ContentType: "text/plain"}},
+		"s3put.nobucket":          {cmd: CmdS3Put{RoleARN: "role", LocalFile: "baz", RemoteFile: "r", ContentType: "text/plain"}},
+		"s3put.noremote":          {cmd: CmdS3Put{RoleARN: "role", LocalFile: "baz", Bucket: "b", ContentType: "text/plain"}},
+		"s3put.nocontenttype":     {cmd: CmdS3Put{RoleARN: "role", LocalFile: "baz", Bucket: "b", RemoteFile: "r"}},
+		"s3get.extract":           {cmd: CmdS3Get{RoleARN: "role", Bucket: "b", RemoteFile: "r", ExtractTo: "dir"}, valid: true},
+		"s3get.nocreds":           {cmd: CmdS3Get{Bucket: "b", RemoteFile: "r", LocalFile: "baz"}},
+		"s3get.nosecret":          {cmd: CmdS3Get{AWSKey: "foo", Bucket: "b", RemoteFile: "r", LocalFile: "baz"}},
+		"s3get.nobucket":          {cmd: CmdS3Get{RoleARN: "role", RemoteFile: "r", LocalFile: "baz"}},
+		"s3get.noremote":          {cmd: CmdS3Get{RoleARN: "role", Bucket: "b", LocalFile: "baz"}},
+		"s3get.nodestination":     {cmd: CmdS3Get{RoleARN: "role", Bucket: "b", RemoteFile: "r"}},
+		"s3get.bothdestinations":  {cmd: CmdS3Get{RoleARN: "role", Bucket: "b", RemoteFile: "r", LocalFile: "baz", ExtractTo: "dir"}},
+		"s3copy.nocreds":          {cmd: CmdS3Copy{Files: validS3Copy().Files}},
+		"s3copy.nofiles":          {cmd: CmdS3Copy{AWSKey: "foo", AWSSecret: "bar"}},
+		"s3copy.role":             {cmd: CmdS3Copy{RoleARN: "role", Files: validS3Copy().Files}, valid: true},
+		"s3copy.nosecret":         {cmd: CmdS3Copy{AWSKey: "foo", Files: validS3Copy().Files}},
+		"s3copy.nosource":         {cmd: *(&CmdS3Copy{AWSKey: "foo", AWSSecret: "bar"}).AddFile(S3Location{Bucket: "src"}, S3Location{Bucket: "dst", Path: "b"})},
+		"s3copy.nodestination":    {cmd: *(&CmdS3Copy{AWSKey: "foo", AWSSecret: "bar"}).AddFile(S3Location{Bucket: "src", Path: "a"}, S3Location{Path: "b"})},
+		"s3push.negativeretries":  {cmd: CmdS3Push{MaxRetries: -1}},
+		"s3pull.notask":           {cmd: CmdS3Pull{}},
+		"s3pull.negativeretries":  {cmd: CmdS3Pull{Task: "compile", MaxRetries: -1}},
+		"setexpansions.nofile":    {cmd: CmdSetExpansions{IgnoreMissingFile: "true"}},
+		"getproject.nodirectory":  {cmd: CmdGetProject{ShallowClone: true}},
+		"results.nofile":          {cmd: CmdResultsJSON{}},
+		"xunit.files":             {cmd: CmdResultsXunit{Files: []string{"*.xml"}}, valid: true},
+		"xunit.nofiles":           {cmd: CmdResultsXunit{}},
+		"gotest.nofiles":          {cmd: CmdResultsGoTest{}},
+		"archivecreate.notarget":  {cmd: CmdArchiveCreate{Format: ZIP, SourceDir: "dist", Include: []string{"*"}}},
+		"archivecreate.nosource":  {cmd: CmdArchiveCreate{Format: ZIP, Target: "out.zip", Include: []string{"*"}}},
+		"archivecreate.noinclude": {cmd: CmdArchiveCreate{Format: ZIP, Target: "out.zip", SourceDir: "dist"}},
+		"archiveextract.nopath":   {cmd: CmdArchiveExtract{Format: ZIP, TargetDirectory: "out"}},
+		"archiveextract.nodest":   {cmd: CmdArchiveExtract{Format: ZIP, ArchivePath: "in.zip"}},
+		"artifacts.nofiles":       {cmd: CmdAttachArtifacts{Prefix: "dist"}},
+		"hostcreate.ami":          {cmd: CmdHostCreate{AMI: "ami-1", InstanceType: "m5.large", SecurityGroups: []string{"sg-1"}}, valid: true},
+		"hostcreate.docker":       {cmd: CmdHostCreate{CloudProvider: "docker", Image: "ubuntu:22.04", Scope: "build"}, valid: true},
+		"hostcreate.file":         {cmd: CmdHostCreate{File: "hosts.yml", Scope: "task"}, valid: true},
+		"hostcreate.noimage":      {cmd: CmdHostCreate{CloudProvider: "docker", Distro: "ubuntu"}},
+		"hostcreate.nodistro":     {cmd: CmdHostCreate{CloudProvider: "ec2"}},
+		"hostcreate.distroandami": {cmd: CmdHostCreate{Distro: "ubuntu", AMI: "ami-1", InstanceType: "m5.large", SecurityGroups: []string{"sg-1"}}},
+		"hostcreate.amitype":      {cmd: CmdHostCreate{AMI: "ami-1", SecurityGroups: []string{"sg-1"}}},
+		"hostcreate.amigroups":    {cmd: CmdHostCreate{AMI: "ami-1", InstanceType: "m5.large"}},
+		"hostcreate.provider":     {cmd: CmdHostCreate{CloudProvider: "gce", Distro: "ubuntu"}},
+		"hostcreate.scope":        {cmd: CmdHostCreate{Distro: "ubuntu", Scope: "version"}},
+		"hostcreate.filescope":    {cmd: CmdHostCreate{File: "hosts.yml", Scope: "version"}},
+		"hostcreate.retries":      {cmd: CmdHostCreate{Distro: "ubuntu", Retries: -1}},
+		"hostcreate.timeout":      {cmd: CmdHostCreate{Distro: "ubuntu", SetupTimeoutSecs: -1}},
+		"hostlist.wait":           {cmd: CmdHostList{Wait: true, NumHosts: "2"}, valid: true},
+		"hostlist.waitnohosts":    {cmd: CmdHostList{Wait: true}},
+		"hostlist.timeout":        {cmd: CmdHostList{TimeoutSecs: -1}},
+		"expansionsupdate.key":    {cmd: CmdExpansionsUpdate{Updates: []ExpansionUpdateParams{{Key: "a", Value: "b"}}}, valid: true},
+		"expansionsupdate.nokey":  {cmd: CmdExpansionsUpdate{Updates: []ExpansionUpdateParams{{Key: "a"}, {Value: "b"}}}},
+		"expansionswrite.nofile":  {cmd: CmdExpansionsWrite{Redacted: true}},
+		"jsonsend.nofile":         {cmd: CmdJSONSend{DataName: "data"}},
+		"jsonsend.noname":         {cmd: CmdJSONSend{File: "data.json"}},
+		"papertrail.nocreds":      {cmd: CmdPapertrailTrace{KeyID: "foo", Product: "shrub", Version: "1.0", Filenames: []string{"shrub.tgz"}}},
+		"papertrail.noproduct":    {cmd: CmdPapertrailTrace{KeyID: "foo", SecretKey: "bar", Version: "1.0", Filenames: []string{"shrub.tgz"}}},
+		"papertrail.noversion":    {cmd: CmdPapertrailTrace{KeyID: "foo", SecretKey: "bar", Product: "shrub", Filenames: []string{"shrub.tgz"}}},
+		"papertrail.nofiles":      {cmd: CmdPapertrailTrace{KeyID: "foo", SecretKey: "bar", Product: "shrub", Version: "1.0"}},
+		"perfsend.bucket":         {cmd: CmdPerfSend{File: "perf.json", Bucket: "b", AWSKey: "foo", AWSSecret: "bar"}, valid: true},
+		"perfsend.nofile":         {cmd: CmdPerfSend{}},
+		"perfsend.bucketnocreds":  {cmd: CmdPerfSend{File: "perf.json", Bucket: "b"}},
+		"timeoutupdate.exec":      {cmd: CmdTimeoutUpdate{ExecTimeoutSecs: 60}, valid: true},
+		"timeoutupdate.none":      {cmd: CmdTimeoutUpdate{}},
+		"timeoutupdate.negative":  {cmd: CmdTimeoutUpdate{TimeoutSecs: 60, ExecTimeoutSecs: -1}},
+		"token.repo":              {cmd: CmdGitHubGenerateToken{ExpansionName: "token", Owner: "evergreen-ci", Repo: "shrub"}, valid: true},
+		"token.noexpansion":       {cmd: CmdGitHubGenerateToken{Owner: "evergreen-ci", Repo: "shrub"}},
+		"token.noowner":           {cmd: CmdGitHubGenerateToken{ExpansionName: "token", Repo: "shrub"}},
+		"token.norepo":            {cmd: CmdGitHubGenerateToken{ExpansionName: "token", Owner: "evergreen-ci"}},
+		"testselection.nooutput":  {cmd: CmdTestSelectionGet{TestsFile: "tests.txt"}},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := test.cmd.Validate()
+			if test.valid {
+				assert(t, err == nil, errString(err))
+			} else {
+				assert(t, err != nil)
+			}
+		})
+	}
+}
+
+func TestS3CopyFiles(t *testing.T) {
+	const payload = `{"aws_key":"foo","aws_secret":"bar","aws_session_token":"","s3_copy_files":[` +
+		`{"source":{"bucket":"src","path":"a","region":"us-east-1"},"destination":{"bucket":"dst","path":"b"}},` +
+		`{"source":{"bucket":"src","path":"c"},"destination":{"bucket":"dst","path":"d"},"display_name":"d","build_variants":["ubuntu"],"optional":true}]}`
+
+	cmd := &CmdS3Copy{AWSKey: "foo", AWSSecret: "bar"}
+	cmd.AddFile(S3Location{Bucket: "src", Path: "a", Region: "us-east-1"}, S3Location{Bucket: "dst", Path: "b"}).
+		AddFiles(S3CopyFile{
+			Source:        S3Location{Bucket: "src", Path: "c"},
+			Destination:   S3Location{Bucket: "dst", Path: "d"},
+			DisplayName:   "d",
+			BuildVariants: []string{"ubuntu"},
+			Optional:      true,
+		})
+	require(t, len(cmd.Files) == 2)
+
+	t.Run("Marshal", func(t *testing.T) {
+		out, err := json.Marshal(cmd)
+		require(t, err == nil, errString(err))
+		assert(t, string(out) == payload, string(out))
+	})
+	t.Run("Unmarshal", func(t *testing.T) {
+		parsed := CmdS3Copy{}
+		require(t, json.Unmarshal([]byte(payload), &parsed) == nil)
+		assert(t, reflect.DeepEqual(parsed, *cmd))
+	})
+	t.Run("Typed", func(t *testing.T) {
+		typed, err := cmd.Resolve().Typed()
+		require(t, err == nil, errString(err))
+		assert(t, reflect.DeepEqual(typed, *cmd))
+	})
+}
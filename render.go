@@ -0,0 +1,236 @@
+package shrub
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Render returns the commands that the task runs on the build variant,
+// as Evergreen would resolve them, so that generated configurations can
+// be checked without running them.
+//
+// Function calls are replaced by the function's commands, with the
+// call's vars added to the expansions while those commands run; the
+// keys the function sets with expansions.update remain set after it.
+// Commands (and function calls) restricted to other variants are
+// omitted. Expansion references in the commands' parameters are then
+// replaced using the variant's expansions, the task_name and
+// build_variant expansions, and the extra expansions, which take
+// precedence; undefined expansions without defaults are replaced with
+// an empty string. The keys set by expansions.update commands are
+// available to the commands that follow them.
+//
+// Only the task's own commands are rendered, not those of the task
+// group hooks or the project's pre, post and timeout commands. The
+// returned commands are copies and do not share parameters with the
+// configuration.
+func (c *Configuration) Render(variant, task string, extra map[string]string) (CommandSequence, error) {
+	v := c.findVariant(variant)
+	if v == nil {
+		return nil, fmt.Errorf("build variant '%s' is not defined", variant)
+	}
+	t := c.findTask(task)
+	if t == nil {
+		return nil, fmt.Errorf("task '%s' is not defined", task)
+	}
+
+	runs := false
+	for _, spec := range v.TaskSpecs {
+		for _, name := range c.taskSpecTasks(spec) {
+			if name == task {
+				runs = true
+			}
+		}
+	}
+	if !runs {
+		return nil, fmt.Errorf("task '%s' does not run on build variant '%s'", task, variant)
+	}
+
+	expansions := map[string]string{
+		"task_name":     task,
+		"build_variant": variant,
+	}
+	for k, val := range v.Expansions {
+		if s, ok := val.(string); ok {
+			expansions[k] = s
+		} else {
+			expansions[k] = fmt.Sprint(val)
+		}
+	}
+	for k, val := range extra {
+		expansions[k] = val
+	}
+
+	r := &renderer{conf: c, variant: variant, expansions: expansions, out: CommandSequence{}}
+	if err := r.sequence(t.Commands, nil); err != nil {
+		return nil, err
+	}
+
+	return r.out, nil
+}
+
+type renderer struct {
+	conf       *Configuration
+	variant    string
+	expansions map[string]string
+	out        CommandSequence
+}
+
+func (r *renderer) sequence(seq CommandSequence, calling []string) error {
+	for _, cmd := range seq {
+		if cmd == nil || (len(cmd.RunVariants) > 0 && !containsString(cmd.RunVariants, r.variant)) {
+			continue
+		}
+
+		if cmd.FunctionName != "" {
+			if err := r.call(cmd, calling); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := r.command(cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *renderer) call(cmd *CommandDefinition, calling []string) error {
+	name := cmd.FunctionName
+	if containsString(calling, name) {
+		return fmt.Errorf("function '%s' calls itself: %s", name, strings.Join(append(calling, name), " -> "))
+	}
+	fn, ok := r.conf.Functions[name]
+	if !ok {
+		return fmt.Errorf("function '%s' is not defined", name)
+	}
+	if fn == nil {
+		return nil
+	}
+
+	// The call's vars are only visible within the function, but the
+	// keys set by expansions.update commands in the function are kept.
+	previous := make(map[string]string, len(cmd.Vars))
+	values := make(map[string]string, len(cmd.Vars))
+	for k, val := range cmd.Vars {
+		values[k] = expandString(val, r.expansions)
+	}
+	for k, val := range values {
+		if old, ok := r.expansions[k]; ok {
+			previous[k] = old
+		}
+		r.expansions[k] = val
+	}
+	defer func() {
+		for k := range cmd.Vars {
+			if old, ok := previous[k]; ok {
+				r.expansions[k] = old
+			} else {
+				delete(r.expansions, k)
+			}
+		}
+	}()
+
+	return r.sequence(*fn, append(calling, name))
+}
+
+func (r *renderer) command(cmd *CommandDefinition) error {
+	out := *cmd
+	out.Vars = nil
+	out.Params = nil
+
+	if cmd.Params != nil {
+		data, err := json.Marshal(cmd.Params)
+		if err != nil {
+			return fmt.Errorf("rendering params of command '%s': %w", cmd.CommandName, err)
+		}
+		params := map[string]interface{}{}
+		if err := json.Unmarshal(data, &params); err != nil {
+			return fmt.Errorf("rendering params of command '%s': %w", cmd.CommandName, err)
+		}
+		out.Params = expandValue(params, r.expansions).(map[string]interface{})
+	}
+
+	if out.CommandName == "expansions.update" {
+		updates, _ := out.Params["updates"].([]interface{})
+		for _, update := range updates {
+			u, _ := update.(map[string]interface{})
+			key, _ := u["key"].(string)
+			if key == "" {
+				continue
+			}
+			if concat, ok := u["concat"].(string); ok && concat != "" {
+				r.expansions[key] += concat
+			} else {
+				value, _ := u["value"].(string)
+				r.expansions[key] = value
+			}
+		}
+	}
+
+	r.out = append(r.out, &out)
+	return nil
+}
+
+func expandValue(val interface{}, expansions map[string]string) interface{} {
+	switch v := val.(type) {
+	case string:
+		return expandString(v, expansions)
+	case map[string]interface{}:
+		for k, elem := range v {
+			v[k] = expandValue(elem, expansions)
+		}
+		return v
+	case []interface{}:
+		for idx, elem := range v {
+			v[idx] = expandValue(elem, expansions)
+		}
+		return v
+	default:
+		return val
+	}
+}
+
+// expandString replaces the expansion references in the string, using
+// the same syntax as ParseExpansions.
+func expandString(s string, expansions map[string]string) string {
+	return replaceExpansions(s, func(ref ExpansionReference, _ string) string {
+		switch val, ok := expansions[ref.Name]; {
+		case ok:
+			return val
+		case strings.HasPrefix(ref.Default, "*"):
+			return expansions[ref.Default[1:]]
+		default:
+			return ref.Default
+		}
+	})
+}
+
+// replaceExpansions replaces each expansion reference in the string
+// with the result of the function, which is given the parsed reference
+// and its original text.
+func replaceExpansions(s string, replace func(ref ExpansionReference, raw string) string) string {
+	var buf strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
+			break
+		}
+
+		raw := s[start : start+end+1]
+		buf.WriteString(s[:start])
+		buf.WriteString(replace(ParseExpansions(raw)[0], raw))
+
+		s = s[start+end+1:]
+	}
+	buf.WriteString(s)
+
+	return buf.String()
+}
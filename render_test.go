@@ -0,0 +1,121 @@
+package shrub
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	cases := map[string]func(*testing.T, *Configuration){
+		"Resolved": func(t *testing.T, conf *Configuration) {
+			conf.Function("setup").Add(CmdGetProject{Directory: "${workdir}/src"})
+			conf.Function("test").
+				Add(CmdExecShell{Script: "cd ${workdir}/src && ${go|go} test ${pkg} -run '${run|.*}'"}).
+				Append((&CommandDefinition{}).Command("shell.exec").Param("script", "windows only").Variants("windows"))
+			conf.Task("test").
+				Function("setup").
+				FunctionWithVars("test", map[string]string{"pkg": "./${package}/..."}).
+				Command(
+					CmdExpansionsUpdate{Updates: []ExpansionUpdateParams{
+						{Key: "version", Value: "1.0"},
+						{Key: "version", Concat: "-${task_name}"},
+					}},
+					CmdExec{Binary: "${pkg|none}", Args: []string{"${version}", "${build_variant}", "${missing}", "${gopath|*workdir}"}},
+				)
+			conf.Variant("ubuntu").AddTasks("test").
+				Expansion("workdir", "/data").Expansion("package", "shrub").Expansion("go", "/opt/go/bin/go")
+
+			cmds, err := conf.Render("ubuntu", "test", map[string]string{"run": "TestRender"})
+			require(t, err == nil, errString(err))
+			require(t, len(cmds) == 4, "function calls are inlined and other variants' commands omitted")
+
+			assert(t, cmds[0].CommandName == "git.get_project")
+			assert(t, cmds[0].Params["directory"] == "/data/src")
+			assert(t, cmds[1].FunctionName == "" && cmds[1].Vars == nil)
+			assert(t, cmds[1].Params["script"] == "cd /data/src && /opt/go/bin/go test ./shrub/... -run 'TestRender'",
+				cmds[1].Params["script"].(string))
+			assert(t, cmds[2].CommandName == "expansions.update")
+
+			assert(t, cmds[3].Params["binary"] == "none", "function vars are scoped to the function")
+			args := []string{}
+			for _, arg := range cmds[3].Params["args"].([]interface{}) {
+				args = append(args, arg.(string))
+			}
+			assert(t, strings.Join(args, ",") == "1.0-test,ubuntu,,/data", strings.Join(args, ","))
+
+			original := (*conf.Functions["setup"])[0].Params["directory"]
+			assert(t, original == "${workdir}/src", "configuration is not modified")
+		},
+		"FunctionExpansionUpdates": func(t *testing.T, conf *Configuration) {
+			conf.Function("set version").Add(CmdExpansionsUpdate{Updates: []ExpansionUpdateParams{
+				{Key: "version", Value: "${prefix}1.2"},
+			}})
+			conf.Task("release").
+				FunctionWithVars("set version", map[string]string{"prefix": "v", "mode": "release"}).
+				Command(CmdExecShell{Script: "echo ${version} ${prefix|none} ${mode}"})
+			conf.Variant("ubuntu").AddTasks("release").Expansion("mode", "debug")
+
+			cmds, err := conf.Render("ubuntu", "release", nil)
+			require(t, err == nil, errString(err))
+			require(t, len(cmds) == 2)
+			assert(t, cmds[1].Params["script"] == "echo v1.2 none debug", cmds[1].Params["script"].(string))
+		},
+		"UnknownVariant": func(t *testing.T, conf *Configuration) {
+			conf.Task("test")
+			conf.Variant("ubuntu").AddTasks("test")
+
+			cmds, err := conf.Render("windows", "test", nil)
+			assert(t, err != nil)
+			assert(t, cmds == nil)
+		},
+		"UnknownTask": func(t *testing.T, conf *Configuration) {
+			conf.Task("test")
+			conf.Variant("ubuntu").AddTasks("test")
+
+			cmds, err := conf.Render("ubuntu", "lint", nil)
+			assert(t, err != nil)
+			assert(t, cmds == nil)
+		},
+		"NotInVariant": func(t *testing.T, conf *Configuration) {
+			conf.Task("test")
+			conf.Task("orphan")
+			conf.Variant("ubuntu").AddTasks("test")
+
+			cmds, err := conf.Render("ubuntu", "orphan", nil)
+			assert(t, err != nil)
+			assert(t, cmds == nil)
+		},
+		"Recursive": func(t *testing.T, conf *Configuration) {
+			conf.Function("loop").Append(&CommandDefinition{FunctionName: "loop"})
+			conf.Task("loop").Function("loop")
+			conf.Variant("ubuntu").AddTasks("loop")
+
+			cmds, err := conf.Render("ubuntu", "loop", nil)
+			assert(t, err != nil)
+			assert(t, cmds == nil)
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			test(t, &Configuration{})
+		})
+	}
+}
+
+func TestExpandString(t *testing.T) {
+	expansions := map[string]string{"a": "1", "b": "2", "empty": ""}
+	for input, expected := range map[string]string{
+		"":             "",
+		"plain":        "plain",
+		"${a}${b}":     "12",
+		"${c}":         "",
+		"${c|3}":       "3",
+		"${empty|3}":   "",
+		"${c|*b}":      "2",
+		"${a|*b}":      "1",
+		"x${a}y${open": "x1y${open",
+	} {
+		assert(t, expandString(input, expansions) == expected, input)
+	}
+}
@@ -3,6 +3,7 @@ package shrub
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 // BuildConfiguration provides an interface for building configuration
@@ -10,20 +11,14 @@ import (
 // Configuration objects can panic in some situations, and you can use
 // BuildConfiguration to convert these panics into errors that you can
 // handle conventionally.
+//
+// When a command added to a task or task group is invalid, the error is
+// a *BuildError that identifies the task or group and the command.
 func BuildConfiguration(f func(*Configuration)) (c *Configuration, err error) {
 	defer func() {
 		if p := recover(); p != nil {
 			c = nil
-			switch pm := p.(type) {
-			case error:
-				err = pm
-			case fmt.Stringer:
-				err = errors.New(pm.String())
-			case string:
-				err = errors.New(pm)
-			default:
-				err = fmt.Errorf("%v", pm)
-			}
+			err = recoveredError(p)
 		}
 	}()
 
@@ -33,3 +28,175 @@ func BuildConfiguration(f func(*Configuration)) (c *Configuration, err error) {
 
 	return
 }
+
+// BuildConfigurationCollect is like BuildConfiguration, but rather than
+// stopping at the first invalid command, it skips every invalid command
+// added to a task or task group (with Task.Command,
+// TaskGroup.SetupGroupCommand, etc.) and continues building. If any
+// commands were invalid, it returns a *BuildError that describes every
+// one of them.
+//
+// Only tasks and task groups obtained from the configuration's Task and
+// TaskGroup methods collect failures. Any other panic stops the build
+// and is returned as an error, as with BuildConfiguration.
+func BuildConfigurationCollect(f func(*Configuration)) (c *Configuration, err error) {
+	collector := &buildCollector{}
+	defer func() {
+		if p := recover(); p != nil {
+			c, err = nil, recoveredError(p)
+			return
+		}
+
+		c.stopCollecting()
+		if len(collector.failures) > 0 {
+			c, err = nil, &BuildError{Failures: collector.failures}
+		}
+	}()
+
+	c = &Configuration{collector: collector}
+
+	f(c)
+
+	return
+}
+
+func (c *Configuration) stopCollecting() {
+	c.collector = nil
+	for _, t := range c.Tasks {
+		if t != nil {
+			t.collector = nil
+		}
+	}
+	for _, g := range c.Groups {
+		if g != nil {
+			g.collector = nil
+		}
+	}
+	for _, v := range c.Variants {
+		if v != nil {
+			v.stopCollecting()
+		}
+	}
+}
+
+func (v *Variant) stopCollecting() {
+	for idx := range v.TaskSpecs {
+		if g := v.TaskSpecs[idx].TaskGroup; g != nil {
+			g.collector = nil
+		}
+	}
+}
+
+// BuildFailure describes a command that could not be added to a
+// configuration.
+type BuildFailure struct {
+	// Path identifies the position of the command in the
+	// configuration, e.g. "tasks[compile].commands[2]" or
+	// "task_groups[integration].setup_group[0]". The index is the one
+	// that the command would have had if every command passed in the
+	// same call had been valid.
+	Path string
+	// Command is the name of the command, if it could be determined.
+	Command string
+	Cause   error
+}
+
+func (f BuildFailure) Error() string {
+	if f.Command == "" {
+		return fmt.Sprintf("%s: %v", f.Path, f.Cause)
+	}
+	return fmt.Sprintf("%s (%s): %v", f.Path, f.Command, f.Cause)
+}
+
+func (f BuildFailure) Unwrap() error { return f.Cause }
+
+// BuildError reports the commands that could not be added to a
+// configuration while building it.
+type BuildError struct {
+	Failures []BuildFailure
+}
+
+func (e *BuildError) Error() string {
+	msgs := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		msgs = append(msgs, f.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns each of the failures, so that errors.Is and errors.As
+// match against their causes.
+func (e *BuildError) Unwrap() []error {
+	out := make([]error, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		out = append(out, f)
+	}
+	return out
+}
+
+// buildCollector accumulates the failures of a configuration built with
+// BuildConfigurationCollect.
+type buildCollector struct {
+	failures []BuildFailure
+}
+
+// fail records the failure or, when the configuration is not being
+// built with BuildConfigurationCollect (i.e. the collector is nil),
+// panics with it.
+func (bc *buildCollector) fail(f BuildFailure) {
+	if bc == nil {
+		panic(&BuildError{Failures: []BuildFailure{f}})
+	}
+	bc.failures = append(bc.failures, f)
+}
+
+// ResolveCommand validates the command and resolves it into a command
+// definition, returning an error rather than panicking if the command
+// is invalid.
+func ResolveCommand(cmd Command) (def *CommandDefinition, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			def, err = nil, recoveredError(p)
+		}
+	}()
+
+	if cmd == nil {
+		return nil, errors.New("command is nil")
+	}
+	if err = cmd.Validate(); err != nil {
+		return nil, err
+	}
+	if def = cmd.Resolve(); def == nil {
+		return nil, errors.New("command resolved to nil")
+	}
+
+	return def, nil
+}
+
+// commandName returns the name of the command, or an empty string if
+// the name cannot be determined.
+func commandName(cmd Command) (name string) {
+	defer func() {
+		if recover() != nil {
+			name = ""
+		}
+	}()
+
+	if cmd == nil {
+		return ""
+	}
+	return cmd.Name()
+}
+
+func recoveredError(p interface{}) error {
+	switch pm := p.(type) {
+	case error:
+		return pm
+	case fmt.Stringer:
+		return errors.New(pm.String())
+	case string:
+		return errors.New(pm)
+	default:
+		return fmt.Errorf("%v", pm)
+	}
+}
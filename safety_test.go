@@ -3,6 +3,7 @@ package shrub
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -32,3 +33,73 @@ func TestSafeBuilder(t *testing.T) {
 	}
 
 }
+
+func TestBuildErrors(t *testing.T) {
+	t.Run("FirstFailure", func(t *testing.T) {
+		out, err := BuildConfiguration(func(c *Configuration) {
+			c.Task("upload").Command(CmdExec{Binary: "make"}, CmdS3Put{LocalFile: "dist.tgz"})
+		})
+		assert(t, out == nil)
+		require(t, err != nil)
+
+		var buildErr *BuildError
+		require(t, errors.As(err, &buildErr), "error is a BuildError")
+		require(t, len(buildErr.Failures) == 1)
+		assert(t, buildErr.Failures[0].Path == "tasks[upload].commands[1]", buildErr.Failures[0].Path)
+		assert(t, buildErr.Failures[0].Command == "s3.put")
+		assert(t, err.Error() == "tasks[upload].commands[1] (s3.put): must specify aws credentials", err.Error())
+	})
+	t.Run("Collect", func(t *testing.T) {
+		cause := errors.New("not today")
+		out, err := BuildConfigurationCollect(func(c *Configuration) {
+			c.Task("upload").Command(CmdS3Put{LocalFile: "dist.tgz"}, CmdExec{Binary: "make"}, CmdGenerateTasks{})
+			c.TaskGroup("integration").SetupGroupCommand(CmdArchiveCreate{Format: "rar"}).
+				TeardownTaskCommand(failingCmd{err: cause})
+		})
+		assert(t, out == nil)
+		require(t, err != nil)
+
+		var buildErr *BuildError
+		require(t, errors.As(err, &buildErr), "error is a BuildError")
+		require(t, len(buildErr.Failures) == 4, err.Error())
+
+		paths := []string{}
+		names := []string{}
+		for _, f := range buildErr.Failures {
+			paths = append(paths, f.Path)
+			names = append(names, f.Command)
+		}
+		assert(t, strings.Join(paths, " ") == "tasks[upload].commands[0] tasks[upload].commands[2] task_groups[integration].setup_group[0] task_groups[integration].teardown_task[0]",
+			strings.Join(paths, " "))
+		assert(t, strings.Join(names, ",") == "s3.put,generate.tasks,,failing", "commands whose names panic are unnamed")
+		assert(t, errors.Is(err, cause), "causes are exposed")
+	})
+	t.Run("CollectSucceeds", func(t *testing.T) {
+		out, err := BuildConfigurationCollect(func(c *Configuration) {
+			c.Task("compile").Command(CmdExec{Binary: "make"})
+		})
+		require(t, err == nil, errString(err))
+		require(t, out != nil)
+		assert(t, len(out.Tasks[0].Commands) == 1)
+
+		func() {
+			defer expect(t, "tasks stop collecting after the build")
+			out.Task("compile").Command(CmdS3Put{})
+		}()
+	})
+	t.Run("CollectOtherPanics", func(t *testing.T) {
+		out, err := BuildConfigurationCollect(func(c *Configuration) {
+			c.Task("compile").Command(CmdS3Put{})
+			panic("foo")
+		})
+		assert(t, out == nil)
+		require(t, err != nil)
+		assert(t, err.Error() == "foo")
+	})
+}
+
+type failingCmd struct{ err error }
+
+func (c failingCmd) Name() string                { return "failing" }
+func (c failingCmd) Validate() error             { return c.err }
+func (c failingCmd) Resolve() *CommandDefinition { return &CommandDefinition{CommandName: c.Name()} }
@@ -0,0 +1,141 @@
+package shrub
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Selector is a parsed Evergreen task selector, such as ".lint !.slow".
+// A selector consists of criteria separated by spaces, and selects the
+// tasks that satisfy all of them.
+type Selector []SelectorCriterion
+
+// SelectorCriterion is one of the criteria of a selector. It matches
+// either the task of the given name, the tasks with the given tag (if
+// Tag is set, written ".tag"), or every task (a name of "*"). A negated
+// criterion (written with a leading "!") matches the tasks that the
+// criterion would not otherwise match.
+type SelectorCriterion struct {
+	Name    string
+	Tag     bool
+	Negated bool
+}
+
+// ParseSelector parses a selector string, returning an error if it has
+// no criteria or any criterion is malformed.
+func ParseSelector(s string) (Selector, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, errors.New("selector must have at least one criterion")
+	}
+
+	sel := make(Selector, 0, len(fields))
+	for _, field := range fields {
+		c := SelectorCriterion{Name: field}
+		if strings.HasPrefix(c.Name, "!") {
+			c.Negated = true
+			c.Name = c.Name[1:]
+		}
+		if strings.HasPrefix(c.Name, ".") {
+			c.Tag = true
+			c.Name = c.Name[1:]
+		}
+
+		switch {
+		case c.Name == "":
+			return nil, fmt.Errorf("criterion '%s' has no name", field)
+		case strings.HasPrefix(c.Name, "!"), strings.HasPrefix(c.Name, "."):
+			return nil, fmt.Errorf("criterion '%s' has an invalid name", field)
+		case c.Name == "*" && (c.Tag || c.Negated):
+			return nil, fmt.Errorf("criterion '%s' is not valid, '*' cannot be negated or used as a tag", field)
+		}
+
+		sel = append(sel, c)
+	}
+
+	return sel, nil
+}
+
+func (c SelectorCriterion) String() string {
+	out := c.Name
+	if c.Tag {
+		out = "." + out
+	}
+	if c.Negated {
+		out = "!" + out
+	}
+	return out
+}
+
+func (s Selector) String() string {
+	parts := make([]string, 0, len(s))
+	for _, c := range s {
+		parts = append(parts, c.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// Matches reports whether something with the name and tags satisfies
+// every criterion of the selector.
+func (s Selector) Matches(name string, tags []string) bool {
+	for _, c := range s {
+		var match bool
+		switch {
+		case c.Name == "*":
+			match = true
+		case c.Tag:
+			match = containsString(tags, c.Name)
+		default:
+			match = c.Name == name
+		}
+
+		if match == c.Negated {
+			return false
+		}
+	}
+	return true
+}
+
+// ResolveSelector returns the tasks that the selector matches, in the
+// order in which they are defined. An invalid selector (see
+// ParseSelector) matches no tasks.
+func (c *Configuration) ResolveSelector(sel string) []*Task {
+	s, err := ParseSelector(sel)
+	if err != nil {
+		return nil
+	}
+
+	out := []*Task{}
+	for _, t := range c.Tasks {
+		if t != nil && s.Matches(t.Name, t.Tags) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// selectorTasks returns the names of the tasks that a variant's task
+// spec selects. As in Evergreen, if the selector does not match any
+// tasks, it is matched against the task groups instead, selecting
+// every task in each matching group.
+func (c *Configuration) selectorTasks(sel string) []string {
+	out := []string{}
+	for _, t := range c.ResolveSelector(sel) {
+		out = append(out, t.Name)
+	}
+	if len(out) > 0 {
+		return out
+	}
+
+	s, err := ParseSelector(sel)
+	if err != nil {
+		return nil
+	}
+	for _, g := range c.Groups {
+		if g != nil && s.Matches(g.GroupName, g.Tags) {
+			out = append(out, g.Tasks...)
+		}
+	}
+	return out
+}
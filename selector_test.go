@@ -0,0 +1,117 @@
+package shrub
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	valid := map[string]Selector{
+		".lint":          {{Name: "lint", Tag: true}},
+		"compile":        {{Name: "compile"}},
+		"*":              {{Name: "*"}},
+		" .lint  !.slow": {{Name: "lint", Tag: true}, {Name: "slow", Tag: true, Negated: true}},
+		"* !compile":     {{Name: "*"}, {Name: "compile", Negated: true}},
+	}
+	for input, expected := range valid {
+		t.Run(input, func(t *testing.T) {
+			sel, err := ParseSelector(input)
+			require(t, err == nil, errString(err))
+			require(t, len(sel) == len(expected))
+			for idx := range sel {
+				assert(t, sel[idx] == expected[idx], sel[idx].String())
+			}
+			assert(t, sel.String() == strings.Join(strings.Fields(input), " "), sel.String())
+		})
+	}
+
+	for _, input := range []string{"", "  ", "!", ".", "!.", "..lint", ".!lint", "!!lint", "!*", ".*"} {
+		t.Run("Invalid"+input, func(t *testing.T) {
+			sel, err := ParseSelector(input)
+			assert(t, err != nil, input)
+			assert(t, sel == nil)
+		})
+	}
+}
+
+func TestResolveSelector(t *testing.T) {
+	conf := &Configuration{}
+	conf.Task("compile").Tag("build")
+	conf.Task("lint").Tag("check", "fast")
+	conf.Task("unit").Tag("test", "fast")
+	conf.Task("integration").Tag("test", "slow")
+	conf.Task("e2e").Tag("slow")
+	conf.TaskGroup("smoke").Task("unit", "e2e").Tag("grouped")
+
+	for sel, expected := range map[string]string{
+		".test":          "unit,integration",
+		".test !.slow":   "unit",
+		"!.slow":         "compile,lint,unit",
+		".fast .check":   "lint",
+		"*":              "compile,lint,unit,integration,e2e",
+		"* !compile":     "lint,unit,integration,e2e",
+		"compile":        "compile",
+		"compile .check": "",
+		".missing":       "",
+		".grouped":       "",
+		"!*":             "",
+	} {
+		t.Run(sel, func(t *testing.T) {
+			names := []string{}
+			for _, task := range conf.ResolveSelector(sel) {
+				names = append(names, task.Name)
+			}
+			assert(t, strings.Join(names, ",") == expected, strings.Join(names, ","))
+		})
+	}
+}
+
+func TestTaskSelectorSpecs(t *testing.T) {
+	cases := map[string]func(*testing.T, *Configuration){
+		"AddTaskSelector": func(t *testing.T, conf *Configuration) {
+			v := conf.Variant("ubuntu")
+			v2 := v.AddTaskSelector(" .test  !.slow ")
+			assert(t, v == v2, "chainable")
+			require(t, len(v.TaskSpecs) == 1)
+			assert(t, v.TaskSpecs[0].Name == ".test !.slow")
+		},
+		"InvalidSelectorPanics": func(t *testing.T, conf *Configuration) {
+			defer expect(t, "invalid selector")
+			conf.Variant("ubuntu").AddTaskSelector("!*")
+		},
+		"DependencyGraph": func(t *testing.T, conf *Configuration) {
+			conf.Task("lint").Tag("fast")
+			conf.Task("unit").Tag("fast")
+			conf.Task("e2e").Tag("slow")
+			conf.TaskGroup("smoke").Task("unit", "e2e").Tag("grouped")
+			conf.Variant("ubuntu").AddTaskSelector(".fast").AddTasks("lint")
+			conf.Variant("windows").AddTaskSelector(".grouped")
+
+			instances := []string{}
+			for _, ti := range NewDependencyGraph(conf).Instances() {
+				instances = append(instances, ti.String())
+			}
+			assert(t, strings.Join(instances, ",") == "ubuntu/lint,ubuntu/unit,windows/unit,windows/e2e",
+				strings.Join(instances, ","), "selectors fall back to task groups")
+			assert(t, conf.Validate() == nil, errString(conf.Validate()))
+		},
+		"Render": func(t *testing.T, conf *Configuration) {
+			conf.Task("unit").Tag("test").Command(CmdExec{Binary: "make"})
+			conf.Task("integration").Tag("test", "slow")
+			conf.Variant("ubuntu").AddTaskSelector(".test !.slow")
+
+			cmds, err := conf.Render("ubuntu", "unit", nil)
+			require(t, err == nil, errString(err))
+			assert(t, len(cmds) == 1)
+
+			_, err = conf.Render("ubuntu", "integration", nil)
+			assert(t, err != nil, "tasks excluded by the selector do not run")
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			test(t, &Configuration{})
+		})
+	}
+}
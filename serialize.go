@@ -0,0 +1,430 @@
+package shrub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format describes a serialization format for configurations.
+type Format string
+
+const (
+	JSON Format = "json"
+	YAML Format = "yaml"
+)
+
+func (f Format) Validate() error {
+	switch f {
+	case JSON, YAML:
+		return nil
+	default:
+		return fmt.Errorf("'%s' is not a valid configuration format", f)
+	}
+}
+
+// Write serializes the configuration to the writer in the specified
+// format. Keys are always written in a stable order: struct fields in
+// declaration order and map keys sorted, so that the same
+// configuration always produces byte-identical output. JSON output is
+// indented with four spaces and YAML output with two.
+func (c *Configuration) Write(w io.Writer, f Format) error {
+	switch f {
+	case JSON:
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "    ")
+		return enc.Encode(c)
+	case YAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(c); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return f.Validate()
+	}
+}
+
+// Marshal is a convenience wrapper around Write that returns the
+// serialized configuration.
+func (c *Configuration) Marshal(f Format) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := c.Write(buf, f); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// MarshalYAML implements yaml.Marshaler, so that a configuration
+// encoded by a YAML library, on its own or as part of another
+// document, has the same keys as the output of Write.
+func (c *Configuration) MarshalYAML() (interface{}, error) {
+	type configuration Configuration
+	return (*configuration)(c), nil
+}
+
+// ReadConfiguration parses a configuration in the specified format
+// from the reader.
+func ReadConfiguration(r io.Reader, f Format) (*Configuration, error) {
+	conf := &Configuration{}
+
+	switch f {
+	case JSON:
+		if err := json.NewDecoder(r).Decode(conf); err != nil {
+			return nil, fmt.Errorf("decoding json configuration: %w", err)
+		}
+	case YAML:
+		if err := yaml.NewDecoder(r).Decode(conf); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("decoding yaml configuration: %w", err)
+		}
+	default:
+		return nil, f.Validate()
+	}
+
+	return conf, nil
+}
+
+// FormatFromPath infers the configuration format from the extension
+// of a file name.
+func FormatFromPath(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JSON, nil
+	case ".yml", ".yaml":
+		return YAML, nil
+	default:
+		return "", fmt.Errorf("cannot determine configuration format of '%s'", path)
+	}
+}
+
+// ReadConfigurationFile reads a configuration from the file at the
+// given path, inferring its format from the file extension. This can
+// load an existing Evergreen project file, including files that use
+// YAML anchors and aliases, so that it can be modified with the fluent
+// interface and written back out.
+func ReadConfigurationFile(path string) (*Configuration, error) {
+	format, err := FormatFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	conf, err := ReadConfiguration(f, format)
+	if err != nil {
+		return nil, fmt.Errorf("reading '%s': %w", path, err)
+	}
+
+	return conf, nil
+}
+
+// WriteConfigurationFile writes the configuration to the file at the
+// given path, inferring its format from the file extension. The file is
+// replaced atomically, and an existing file keeps its permissions.
+func WriteConfigurationFile(path string, c *Configuration) error {
+	format, err := FormatFromPath(path)
+	if err != nil {
+		return err
+	}
+
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	data, err := c.Marshal(format)
+	if err != nil {
+		return fmt.Errorf("encoding '%s': %w", path, err)
+	}
+
+	return writeFileAtomic(path, data, perm)
+}
+
+// Unsupported reports the parts of a serialized configuration that are
+// lost when it is read with ReadConfiguration and written back out:
+// keys that do not correspond to any configuration field (such as the
+// "variables" that project files use to hold YAML anchors), and, for
+// YAML, comments and anchors and aliases, which are written out
+// expanded. Each problem is described by a message that starts with the
+// path or line of the offending element. Keys whose values are empty
+// or false are not reported, since leaving them out does not change
+// the configuration.
+func Unsupported(data []byte, f Format) ([]string, error) {
+	conf, err := ReadConfiguration(bytes.NewReader(data), f)
+	if err != nil {
+		return nil, err
+	}
+	written, err := conf.Marshal(JSON)
+	if err != nil {
+		return nil, err
+	}
+
+	var before, after interface{}
+	if err := json.Unmarshal(written, &after); err != nil {
+		return nil, err
+	}
+
+	out := []string{}
+	switch f {
+	case JSON:
+		if err := json.Unmarshal(data, &before); err != nil {
+			return nil, fmt.Errorf("decoding json configuration: %w", err)
+		}
+	case YAML:
+		doc := &yaml.Node{}
+		if err := yaml.Unmarshal(data, doc); err != nil {
+			return nil, fmt.Errorf("decoding yaml configuration: %w", err)
+		}
+		out = append(out, yamlOnlyContent(doc)...)
+		if len(doc.Content) > 0 {
+			if err := doc.Decode(&before); err != nil {
+				return nil, fmt.Errorf("decoding yaml configuration: %w", err)
+			}
+		}
+	}
+
+	return append(out, unknownKeys("", before, after)...), nil
+}
+
+// yamlOnlyContent reports the first comment and the first anchor or
+// alias in the document, neither of which survive decoding.
+func yamlOnlyContent(doc *yaml.Node) []string {
+	var comment, anchor *yaml.Node
+	var walk func(*yaml.Node)
+	walk = func(n *yaml.Node) {
+		if comment == nil && (n.HeadComment != "" || n.LineComment != "" || n.FootComment != "") {
+			comment = n
+		}
+		if anchor == nil && (n.Anchor != "" || n.Kind == yaml.AliasNode) {
+			anchor = n
+		}
+		for _, child := range n.Content {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	out := []string{}
+	if comment != nil {
+		out = append(out, fmt.Sprintf("line %d: comments are not preserved", comment.Line))
+	}
+	if anchor != nil {
+		out = append(out, fmt.Sprintf("line %d: anchors and aliases are expanded", anchor.Line))
+	}
+	return out
+}
+
+// unknownKeys reports the keys of the decoded original document that
+// are missing from the decoded output, allowing for the shorthand forms
+// (a lone value in place of a list) that are normalized on reading and
+// for legacy keys that are renamed.
+func unknownKeys(path string, before, after interface{}) []string {
+	out := []string{}
+	switch b := before.(type) {
+	case map[string]interface{}:
+		switch a := after.(type) {
+		case map[string]interface{}:
+			for _, k := range sortedKeys(b) {
+				val, ok := a[k]
+				if !ok {
+					val, ok = a[legacyKeys[k]]
+				}
+				if !ok {
+					if !isEmptyValue(b[k]) {
+						out = append(out, fmt.Sprintf("%s: unknown key", joinPath(path, k)))
+					}
+					continue
+				}
+				out = append(out, unknownKeys(joinPath(path, k), b[k], val)...)
+			}
+		case []interface{}:
+			if len(a) == 1 {
+				out = append(out, unknownKeys(path, b, a[0])...)
+			}
+		}
+	case []interface{}:
+		if a, ok := after.([]interface{}); ok && len(a) == len(b) {
+			for idx := range b {
+				out = append(out, unknownKeys(fmt.Sprintf("%s[%d]", path, idx), b[idx], a[idx])...)
+			}
+		}
+	}
+	return out
+}
+
+func isEmptyValue(val interface{}) bool {
+	switch v := val.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case string:
+		return v == ""
+	case int:
+		return v == 0
+	case float64:
+		return v == 0
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	default:
+		return false
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Evergreen project files accept several shorthand forms that do not
+// map directly onto the shrub types: a function body may be a single
+// command rather than a list, run_on may be a single string, and task
+// specs and dependencies may be given as plain names. The following
+// YAML unmarshalers normalize those shapes, and also accept the
+// legacyKeys that earlier versions of shrub wrote.
+
+// legacyKeys maps the YAML keys that earlier versions of shrub wrote,
+// which Evergreen does not recognize, to the keys that replaced them.
+var legacyKeys = map[string]string{
+	"priority_override": "priority",
+	"distro":            "distros",
+}
+
+func (s *CommandSequence) UnmarshalYAML(node *yaml.Node) error {
+	node = resolveAlias(node)
+	if node.Kind == yaml.MappingNode {
+		cmd := &CommandDefinition{}
+		if err := node.Decode(cmd); err != nil {
+			return err
+		}
+		*s = CommandSequence{cmd}
+		return nil
+	}
+
+	var cmds []*CommandDefinition
+	if err := node.Decode(&cmds); err != nil {
+		return err
+	}
+	*s = cmds
+	return nil
+}
+
+func (t *Task) UnmarshalYAML(node *yaml.Node) error {
+	type task Task
+	renameLegacyKey(node, "priority_override")
+	normalizeSequences(node, "depends_on", "tags", "run_on", "allowed_requesters")
+	return node.Decode((*task)(t))
+}
+
+func (td *TaskDependency) UnmarshalYAML(node *yaml.Node) error {
+	if n := resolveAlias(node); n.Kind == yaml.ScalarNode {
+		td.Name = n.Value
+		return nil
+	}
+
+	type taskDependency TaskDependency
+	return node.Decode((*taskDependency)(td))
+}
+
+func (v *Variant) UnmarshalYAML(node *yaml.Node) error {
+	type variant Variant
+	normalizeSequences(node, "tags", "tasks", "run_on", "modules", "depends_on", "allowed_requesters")
+	return node.Decode((*variant)(v))
+}
+
+func (ts *TaskSpec) UnmarshalYAML(node *yaml.Node) error {
+	if n := resolveAlias(node); n.Kind == yaml.ScalarNode {
+		ts.Name = n.Value
+		return nil
+	}
+
+	type taskSpec TaskSpec
+	renameLegacyKey(node, "distro")
+	normalizeSequences(node, "distros", "run_on", "depends_on", "allowed_requesters")
+	return node.Decode((*taskSpec)(ts))
+}
+
+// resolveAlias follows YAML aliases to the node that they refer to.
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node != nil && node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+// renameLegacyKey renames the legacy key in a mapping node to the key
+// that replaced it, unless the node already sets the new key.
+func renameLegacyKey(node *yaml.Node, legacy string) {
+	node = resolveAlias(node)
+	if node == nil || node.Kind != yaml.MappingNode {
+		return
+	}
+
+	var found *yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		switch node.Content[i].Value {
+		case legacyKeys[legacy]:
+			return
+		case legacy:
+			found = node.Content[i]
+		}
+	}
+	if found != nil {
+		found.Value = legacyKeys[legacy]
+	}
+}
+
+// normalizeSequences rewrites the values of the given keys in a
+// mapping node so that a lone scalar or mapping is decoded as a
+// one-element sequence. Keys inherited through YAML merge keys ("<<")
+// are normalized as well.
+func normalizeSequences(node *yaml.Node, keys ...string) {
+	node = resolveAlias(node)
+	if node == nil || node.Kind != yaml.MappingNode {
+		return
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, val := node.Content[i].Value, node.Content[i+1]
+		if key == "<<" {
+			merged := resolveAlias(val)
+			if merged.Kind == yaml.SequenceNode {
+				for _, n := range merged.Content {
+					normalizeSequences(n, keys...)
+				}
+			} else {
+				normalizeSequences(merged, keys...)
+			}
+			continue
+		}
+
+		for _, k := range keys {
+			if key != k {
+				continue
+			}
+
+			resolved := resolveAlias(val)
+			if resolved.Kind == yaml.MappingNode || (resolved.Kind == yaml.ScalarNode && resolved.Tag != "!!null") {
+				node.Content[i+1] = &yaml.Node{
+					Kind:    yaml.SequenceNode,
+					Tag:     "!!seq",
+					Content: []*yaml.Node{val},
+				}
+			}
+		}
+	}
+}
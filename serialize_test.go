@@ -0,0 +1,383 @@
+package shrub
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestFormatValidate(t *testing.T) {
+	assert(t, JSON.Validate() == nil)
+	assert(t, YAML.Validate() == nil)
+	assert(t, Format("toml").Validate() != nil)
+	assert(t, Format("").Validate() != nil)
+}
+
+func TestConfigurationSerialization(t *testing.T) {
+	cases := map[string]func(*testing.T, *Configuration){
+		"RoundTrip": func(t *testing.T, conf *Configuration) {
+			conf.Function("setup").Command().Command("git.get_project").Param("directory", "src")
+			conf.Function("run").Command().Command("shell.exec").Param("script", "make ${target}")
+			conf.Task("compile").Function("setup").FunctionWithVars("run", map[string]string{"target": "compile"}).Priority(10)
+			conf.Task("test").Function("setup").Dependency(TaskDependency{Name: "compile"}).Tag("unit", "fast")
+			conf.TaskGroup("group").Task("compile", "test").SetMaxHosts(2)
+			conf.Variant("ubuntu").DisplayName("Ubuntu").RunOn("ubuntu2204-small").
+				AddTasks("compile", "test").
+				TaskSpec(TaskSpec{Name: "group", Distro: []string{"rhel"}})
+
+			for _, format := range []Format{JSON, YAML} {
+				first, err := conf.Marshal(format)
+				require(t, err == nil, errString(err))
+
+				read, err := ReadConfiguration(bytes.NewReader(first), format)
+				require(t, err == nil, errString(err))
+				require(t, read != nil)
+				require(t, len(read.Tasks) == 2)
+				assert(t, read.Tasks[0].PriorityOverride == 10)
+				assert(t, read.Tasks[1].Dependencies[0].Name == "compile")
+				require(t, len(read.Groups) == 1)
+				assert(t, read.Groups[0].MaxHosts == 2)
+				require(t, len(read.Variants) == 1)
+				assert(t, len(read.Variants[0].TaskSpecs) == 3)
+				assert(t, len(read.Variants[0].TaskSpecs[2].Distro) == 1)
+				require(t, len(read.Functions) == 2)
+				assert(t, read.Functions["run"].Len() == 1)
+
+				second, err := read.Marshal(format)
+				require(t, err == nil, errString(err))
+				assert(t, bytes.Equal(first, second), string(format), "output is stable across a round trip")
+			}
+		},
+		"Stable": func(t *testing.T, conf *Configuration) {
+			conf.Function("b").Command().Command("shell.exec").Param("script", "b").Param("env", map[string]string{"b": "2", "a": "1"})
+			conf.Function("a").Command().Command("shell.exec").Param("script", "a")
+			conf.Variant("ubuntu").Expansion("b", "two").Expansion("a", 1).Expansion("c", []string{"three"})
+
+			for _, format := range []Format{JSON, YAML} {
+				first, err := conf.Marshal(format)
+				require(t, err == nil, errString(err))
+				for i := 0; i < 10; i++ {
+					next, err := conf.Clone().Marshal(format)
+					require(t, err == nil, errString(err))
+					assert(t, bytes.Equal(first, next), string(format), "output is byte-identical")
+				}
+			}
+		},
+		"DoesNotEscapeScripts": func(t *testing.T, conf *Configuration) {
+			conf.Function("run").Command().Command("shell.exec").Param("script", "make && echo <done>")
+
+			for _, format := range []Format{JSON, YAML} {
+				out, err := conf.Marshal(format)
+				require(t, err == nil, errString(err))
+				assert(t, strings.Contains(string(out), "&& echo <done>"), string(out))
+			}
+		},
+		"EmptyInput": func(t *testing.T, _ *Configuration) {
+			conf, err := ReadConfiguration(strings.NewReader(""), JSON)
+			assert(t, err != nil, "empty json is invalid")
+			assert(t, conf == nil)
+
+			conf, err = ReadConfiguration(strings.NewReader(""), YAML)
+			require(t, err == nil, errString(err))
+			assert(t, conf != nil)
+		},
+		"YAMLKeys": func(t *testing.T, conf *Configuration) {
+			conf.Function("setup").Command().Command("shell.exec").Param("script", "true")
+			conf.Task("compile").Priority(10)
+			conf.Variant("ubuntu").TaskSpec(TaskSpec{Name: "compile", Distro: []string{"rhel"}})
+
+			out, err := conf.Marshal(YAML)
+			require(t, err == nil, errString(err))
+			assert(t, strings.Contains(string(out), "\n    priority: 10\n"), string(out))
+			assert(t, strings.Contains(string(out), "distros:"), string(out))
+			assert(t, strings.Index(string(out), "functions:") < strings.Index(string(out), "tasks:"), "field order")
+		},
+		"MarshalYAML": func(t *testing.T, conf *Configuration) {
+			conf.Task("compile").Priority(10)
+			conf.Variant("ubuntu").AddTasks("compile")
+			expected, err := conf.Marshal(YAML)
+			require(t, err == nil, errString(err))
+
+			buf := &bytes.Buffer{}
+			enc := yaml.NewEncoder(buf)
+			enc.SetIndent(2)
+			require(t, enc.Encode(conf) == nil)
+			require(t, enc.Close() == nil)
+			assert(t, buf.String() == string(expected), buf.String())
+
+			out, err := yaml.Marshal(map[string]*Configuration{"project": conf})
+			require(t, err == nil, errString(err))
+			assert(t, strings.Contains(string(out), "        priority: 10\n"), string(out))
+		},
+		"LegacyYAMLKeys": func(t *testing.T, _ *Configuration) {
+			conf, err := ReadConfiguration(strings.NewReader(`
+tasks:
+  - name: compile
+    priority_override: 10
+  - name: test
+    priority_override: 1
+    priority: 5
+buildvariants:
+  - name: ubuntu
+    tasks:
+      - name: compile
+        distro: rhel80
+`), YAML)
+			require(t, err == nil, errString(err))
+			assert(t, conf.Tasks[0].PriorityOverride == 10)
+			assert(t, conf.Tasks[1].PriorityOverride == 5, "the current key takes precedence")
+			assert(t, strings.Join(conf.Variants[0].TaskSpecs[0].Distro, ",") == "rhel80")
+		},
+		"InvalidFormat": func(t *testing.T, conf *Configuration) {
+			conf.Task("compile")
+			out, err := conf.Marshal(Format("toml"))
+			assert(t, err != nil)
+			assert(t, out == nil)
+
+			read, err := ReadConfiguration(strings.NewReader("{}"), Format("toml"))
+			assert(t, err != nil)
+			assert(t, read == nil)
+		},
+		"MalformedInput": func(t *testing.T, _ *Configuration) {
+			conf, err := ReadConfiguration(strings.NewReader("{"), JSON)
+			assert(t, err != nil)
+			assert(t, conf == nil)
+
+			conf, err = ReadConfiguration(strings.NewReader("tasks: {"), YAML)
+			assert(t, err != nil)
+			assert(t, conf == nil)
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			test(t, &Configuration{})
+		})
+	}
+}
+
+func TestReadProjectFile(t *testing.T) {
+	t.Run("RepositoryConfiguration", func(t *testing.T) {
+		conf, err := ReadConfigurationFile("evergreen.yaml")
+		require(t, err == nil, errString(err))
+		require(t, conf != nil)
+		assert(t, conf.Validate() == nil, errString(conf.Validate()))
+
+		assert(t, conf.CommandType == "test")
+		require(t, conf.Stepback != nil)
+		assert(t, !*conf.Stepback)
+		assert(t, len(conf.IgnoredFiles) == 3)
+		require(t, len(conf.PostCommands) == 1)
+		assert(t, conf.PostCommands[0].FunctionName == "parse-results")
+
+		require(t, len(conf.Functions) == 3)
+		assert(t, conf.Functions["get-project-and-modules"].Len() == 2, "list function body")
+		assert(t, conf.Functions["run-make"].Len() == 1, "single command function body")
+		assert(t, conf.Functions["parse-results"].Len() == 1, "single command function body")
+		assert(t, (*conf.Functions["run-make"])[0].Params["binary"] == "make")
+
+		require(t, len(conf.Tasks) == 3)
+		test := conf.Task("test-shrub")
+		require(t, len(conf.Tasks) == 3, "task exists")
+		require(t, len(test.Commands) == 2, "commands come from anchor")
+		assert(t, test.Commands[1].Vars["target"] == "${task_name}")
+		require(t, test.MustHaveResults != nil && *test.MustHaveResults)
+		require(t, len(test.Tags) == 1)
+		assert(t, test.Tags[0] == "test")
+		assert(t, conf.Task("lint-shrub").Tags[0] == "report")
+
+		require(t, len(conf.Variants) == 2)
+		ubuntu := conf.Variant("ubuntu")
+		require(t, len(conf.Variants) == 2, "variant exists")
+		assert(t, ubuntu.BuildDisplayName == "Ubuntu 22.04")
+		assert(t, ubuntu.Expansions["GOROOT"] == "/opt/golang/go1.24")
+		require(t, len(ubuntu.DistroRunOn) == 1)
+		require(t, len(ubuntu.TaskSpecs) == 1)
+		assert(t, ubuntu.TaskSpecs[0].Name == ".test")
+	})
+	t.Run("ModifyAndRewrite", func(t *testing.T) {
+		conf, err := ReadConfigurationFile("evergreen.yaml")
+		require(t, err == nil, errString(err))
+
+		conf.Task("race-shrub").Function("get-project-and-modules").FunctionWithVars("run-make", map[string]string{"target": "test"})
+		conf.Variant("ubuntu").AddTasks("race-shrub")
+
+		out, err := conf.Marshal(YAML)
+		require(t, err == nil, errString(err))
+
+		reread, err := ReadConfiguration(bytes.NewReader(out), YAML)
+		require(t, err == nil, errString(err))
+		assert(t, len(reread.Tasks) == 4)
+		assert(t, len(reread.Variant("ubuntu").TaskSpecs) == 2)
+		assert(t, reread.Validate() == nil, errString(reread.Validate()))
+	})
+	t.Run("ShorthandForms", func(t *testing.T) {
+		conf, err := ReadConfiguration(strings.NewReader(`
+tasks:
+  - name: compile
+    run_on: rhel80
+    depends_on: setup
+    commands:
+      command: shell.exec
+  - name: setup
+buildvariants:
+  - name: ubuntu
+    run_on: ubuntu2204-small
+    tasks:
+      - compile
+      - name: setup
+        run_on: ubuntu2204-large
+        depends_on:
+          name: compile
+          variant: rhel
+  - name: rhel
+    run_on: [rhel80, rhel90]
+    tasks: compile
+`), YAML)
+		require(t, err == nil, errString(err))
+
+		compile := conf.Tasks[0]
+		require(t, len(compile.DistroRunOn) == 1)
+		assert(t, compile.DistroRunOn[0] == "rhel80")
+		require(t, len(compile.Dependencies) == 1)
+		assert(t, compile.Dependencies[0].Name == "setup")
+		require(t, len(compile.Commands) == 1)
+		assert(t, compile.Commands[0].CommandName == "shell.exec")
+
+		ubuntu := conf.Variants[0]
+		require(t, len(ubuntu.DistroRunOn) == 1)
+		assert(t, ubuntu.DistroRunOn[0] == "ubuntu2204-small")
+		require(t, len(ubuntu.TaskSpecs) == 2)
+		assert(t, ubuntu.TaskSpecs[0].Name == "compile")
+		require(t, len(ubuntu.TaskSpecs[1].RunOn) == 1)
+		require(t, len(ubuntu.TaskSpecs[1].DependsOn) == 1)
+		assert(t, ubuntu.TaskSpecs[1].DependsOn[0].Variant == "rhel")
+
+		rhel := conf.Variants[1]
+		assert(t, len(rhel.DistroRunOn) == 2)
+		require(t, len(rhel.TaskSpecs) == 1)
+		assert(t, rhel.TaskSpecs[0].Name == "compile")
+
+		assert(t, conf.Validate() == nil, errString(conf.Validate()))
+	})
+	t.Run("UnknownExtension", func(t *testing.T) {
+		conf, err := ReadConfigurationFile("evergreen.toml")
+		assert(t, err != nil)
+		assert(t, conf == nil)
+	})
+	t.Run("MissingFile", func(t *testing.T) {
+		conf, err := ReadConfigurationFile("does-not-exist.yml")
+		assert(t, err != nil)
+		assert(t, conf == nil)
+	})
+}
+
+func TestFormatFromPath(t *testing.T) {
+	for path, expected := range map[string]Format{
+		"generated.json":  JSON,
+		"evergreen.yml":   YAML,
+		"evergreen.YAML":  YAML,
+		"dir.d/file.yaml": YAML,
+	} {
+		format, err := FormatFromPath(path)
+		assert(t, err == nil, path)
+		assert(t, format == expected, path)
+	}
+
+	for _, path := range []string{"", "evergreen", "evergreen.txt"} {
+		_, err := FormatFromPath(path)
+		assert(t, err != nil, path)
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	t.Run("RepositoryConfiguration", func(t *testing.T) {
+		data, err := os.ReadFile("evergreen.yaml")
+		require(t, err == nil, errString(err))
+
+		problems, err := Unsupported(data, YAML)
+		require(t, err == nil, errString(err))
+		assert(t, strings.Join(problems, "\n") == "line 11: comments are not preserved\n"+
+			"line 12: anchors and aliases are expanded\n"+
+			"variables: unknown key", strings.Join(problems, "\n"))
+	})
+	t.Run("ShorthandForms", func(t *testing.T) {
+		problems, err := Unsupported([]byte(`
+tasks:
+  - name: compile
+    run_on: rhel80
+    depends_on: setup
+    commands:
+      command: shell.exec
+buildvariants:
+  - name: ubuntu
+    tasks: [compile, {name: lint, distros: rhel80}]
+task_groups:
+  - name: group
+    share_processes: false
+    tasks: [compile]
+`), YAML)
+		require(t, err == nil, errString(err))
+		assert(t, len(problems) == 0, problems...)
+	})
+	t.Run("LegacyKeys", func(t *testing.T) {
+		problems, err := Unsupported([]byte(`
+tasks:
+  - name: compile
+    priority_override: 10
+buildvariants:
+  - name: ubuntu
+    tasks: [{name: compile, distro: rhel80}]
+`), YAML)
+		require(t, err == nil, errString(err))
+		assert(t, len(problems) == 0, problems...)
+	})
+	t.Run("UnknownKeys", func(t *testing.T) {
+		problems, err := Unsupported([]byte(`{"tasks": [{"name": "compile", "timeout": 10, "extra": false}], "owner": "me"}`), JSON)
+		require(t, err == nil, errString(err))
+		assert(t, strings.Join(problems, ",") == "owner: unknown key,tasks[0].timeout: unknown key", problems...)
+	})
+	t.Run("Malformed", func(t *testing.T) {
+		_, err := Unsupported([]byte("tasks: {"), YAML)
+		assert(t, err != nil)
+	})
+}
+
+func TestWriteConfigurationFile(t *testing.T) {
+	t.Run("KeepsPermissions", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "evergreen.yml")
+		require(t, os.WriteFile(path, []byte("old contents"), 0600) == nil)
+
+		conf := &Configuration{}
+		conf.Task("compile")
+		require(t, WriteConfigurationFile(path, conf) == nil)
+		conf, err := ReadConfigurationFile(path)
+		require(t, err == nil, errString(err))
+		assert(t, len(conf.Tasks) == 1)
+
+		info, err := os.Stat(path)
+		require(t, err == nil, errString(err))
+		assert(t, info.Mode().Perm() == 0600, info.Mode().String())
+
+		entries, err := os.ReadDir(dir)
+		require(t, err == nil, errString(err))
+		assert(t, len(entries) == 1, "no temporary files are left behind")
+	})
+	t.Run("NewFile", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "generated.json")
+		conf := &Configuration{}
+		conf.Task("compile")
+		require(t, WriteConfigurationFile(path, conf) == nil)
+		conf, err := ReadConfigurationFile(path)
+		require(t, err == nil, errString(err))
+		assert(t, len(conf.Tasks) == 1)
+	})
+	t.Run("UnknownExtension", func(t *testing.T) {
+		assert(t, WriteConfigurationFile(filepath.Join(t.TempDir(), "evergreen.toml"), &Configuration{}) != nil)
+	})
+}
@@ -0,0 +1,242 @@
+package shrub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The vars that Shard adds to the function calls of each shard.
+const (
+	// ShardTestsVar holds the tests that the shard runs, separated by
+	// spaces.
+	ShardTestsVar = "shard_tests"
+	// ShardIndexVar holds the zero-based index of the shard.
+	ShardIndexVar = "shard_index"
+	// ShardCountVar holds the total number of shards.
+	ShardCountVar = "shard_count"
+)
+
+// ShardOptions describes how Shard divides a suite of tests.
+type ShardOptions struct {
+	// Tests are the distinct identifiers of the tests to divide between
+	// the shards, e.g. as read by ReadSelectedTests.
+	Tests []string
+	// Shards is the number of shards to produce. If it is not set, the
+	// number of shards is chosen so that each shard takes about
+	// TargetDuration. There are never more shards than tests.
+	Shards int
+	// TargetDuration is the approximate duration of each shard, based
+	// on the Timings. It is only used if Shards is not set.
+	TargetDuration time.Duration
+	// Timings are the historical durations of the tests. Tests without
+	// a timing are assumed to take the average duration of the tests
+	// with one; if there are no timings, every test is assumed to take
+	// the same time.
+	Timings map[string]time.Duration
+}
+
+// Validate checks that the options specify distinct tests and either a
+// number of shards or a target duration with timings.
+func (o ShardOptions) Validate() error {
+	seen := make(map[string]bool, len(o.Tests))
+	for _, test := range o.Tests {
+		if seen[test] {
+			return fmt.Errorf("test '%s' is listed more than once", test)
+		}
+		seen[test] = true
+	}
+
+	switch {
+	case len(o.Tests) == 0:
+		return errors.New("must specify at least one test to shard")
+	case o.Shards < 0:
+		return errors.New("number of shards cannot be negative")
+	case o.Shards > 0:
+		return nil
+	case o.TargetDuration <= 0:
+		return errors.New("must specify either a number of shards or a target duration")
+	case len(o.Timings) == 0:
+		return errors.New("must specify timings to shard by target duration")
+	default:
+		return nil
+	}
+}
+
+// Shard divides the tests between copies of the template task, adds
+// the copies to the configuration and to the build variant (which is
+// created if necessary), and groups them in a display task with the
+// template's name. It returns the shard tasks.
+//
+// Tests are assigned to the shard with the least total duration so
+// far, longest tests first, so that the shards take about the same
+// time. The shard tasks are named after the template with the index of
+// the shard appended (e.g. "test_0", "test_1"), and every function call
+// in their commands is given the ShardTestsVar, ShardIndexVar and
+// ShardCountVar vars, which the functions can use to run the shard's
+// tests. Each shard keeps the template's dependencies, tags and other
+// settings. The template itself is not added to the configuration.
+func (c *Configuration) Shard(variant string, template *Task, opts ShardOptions) ([]*Task, error) {
+	if template == nil || template.Name == "" {
+		return nil, errors.New("must specify a named template task")
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	calls := false
+	for _, cmd := range template.Commands {
+		calls = calls || (cmd != nil && cmd.FunctionName != "")
+	}
+	if !calls {
+		return nil, fmt.Errorf("template task '%s' must call a function to receive the shard's tests", template.Name)
+	}
+
+	shards := shardTests(opts)
+	width := len(strconv.Itoa(len(shards) - 1))
+
+	names := make([]string, len(shards))
+	for idx := range shards {
+		names[idx] = fmt.Sprintf("%s_%0*d", template.Name, width, idx)
+		if c.findTask(names[idx]) != nil || c.findGroup(names[idx]) != nil {
+			return nil, fmt.Errorf("task '%s' is already defined", names[idx])
+		}
+	}
+	if c.findTask(template.Name) != nil || c.findGroup(template.Name) != nil {
+		return nil, fmt.Errorf("display task '%s' has the same name as a task", template.Name)
+	}
+
+	out := make([]*Task, 0, len(shards))
+	for idx, tests := range shards {
+		t := template.Clone()
+		t.Name = names[idx]
+		t.collector = c.collector
+
+		for _, cmd := range t.Commands {
+			if cmd != nil && cmd.FunctionName != "" {
+				cmd.Var(ShardTestsVar, strings.Join(tests, " ")).
+					Var(ShardIndexVar, strconv.Itoa(idx)).
+					Var(ShardCountVar, strconv.Itoa(len(shards)))
+			}
+		}
+
+		c.Tasks = append(c.Tasks, t)
+		out = append(out, t)
+	}
+
+	c.Variant(variant).AddTasks(names...).DisplayTasks(DisplayTaskDefinition{
+		Name:       template.Name,
+		Components: names,
+	})
+
+	return out, nil
+}
+
+// shardTests divides the tests into shards using the longest
+// processing time first rule, breaking ties between equally loaded
+// shards by the number of tests, so that tests without a duration are
+// spread evenly. The tests within each shard are kept in the order in
+// which they were given.
+func shardTests(opts ShardOptions) [][]string {
+	var known time.Duration
+	count := 0
+	for _, test := range opts.Tests {
+		if d, ok := opts.Timings[test]; ok {
+			known += d
+			count++
+		}
+	}
+	fallback := time.Second
+	if count > 0 {
+		fallback = known / time.Duration(count)
+	}
+
+	durations := make([]time.Duration, len(opts.Tests))
+	var total time.Duration
+	for idx, test := range opts.Tests {
+		d, ok := opts.Timings[test]
+		if !ok {
+			d = fallback
+		}
+		durations[idx] = d
+		total += d
+	}
+
+	n := opts.Shards
+	if n == 0 {
+		n = int((total + opts.TargetDuration - 1) / opts.TargetDuration)
+	}
+	if n > len(opts.Tests) {
+		n = len(opts.Tests)
+	}
+	if n < 1 {
+		n = 1
+	}
+
+	order := make([]int, len(opts.Tests))
+	for idx := range order {
+		order[idx] = idx
+	}
+	sort.SliceStable(order, func(i, j int) bool { return durations[order[i]] > durations[order[j]] })
+
+	assigned := make([]int, len(opts.Tests))
+	loads := make([]time.Duration, n)
+	counts := make([]int, n)
+	for _, idx := range order {
+		shard := 0
+		for s := range loads {
+			if loads[s] < loads[shard] || (loads[s] == loads[shard] && counts[s] < counts[shard]) {
+				shard = s
+			}
+		}
+		assigned[idx] = shard
+		loads[shard] += durations[idx]
+		counts[shard]++
+	}
+
+	shards := make([][]string, n)
+	for idx, test := range opts.Tests {
+		shards[assigned[idx]] = append(shards[assigned[idx]], test)
+	}
+	return shards
+}
+
+// ReadSelectedTests reads the tests from a file written by the
+// test_selection.get command (see CmdTestSelectionGet), which contains
+// a JSON object with a "tests" list, for use as ShardOptions.Tests.
+// Each test may be either a string or an object with a "name".
+func ReadSelectedTests(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc struct {
+		Tests []json.RawMessage `json:"tests"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("decoding selected tests: %w", err)
+	}
+
+	out := make([]string, 0, len(doc.Tests))
+	for idx, raw := range doc.Tests {
+		var name string
+		if err := json.Unmarshal(raw, &name); err != nil {
+			var test struct {
+				Name string `json:"name"`
+			}
+			if err := json.Unmarshal(raw, &test); err != nil || test.Name == "" {
+				return nil, fmt.Errorf("test %d is neither a name nor an object with a name", idx)
+			}
+			name = test.Name
+		}
+		out = append(out, name)
+	}
+
+	return out, nil
+}
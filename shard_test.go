@@ -0,0 +1,171 @@
+package shrub
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func shardTemplate() *Task {
+	return (&Task{Name: "test"}).
+		Function("setup").
+		FunctionWithVars("run tests", map[string]string{"suite": "unit"}).
+		Dependency(TaskDependency{Name: "compile"})
+}
+
+func TestShard(t *testing.T) {
+	t.Run("Count", func(t *testing.T) {
+		conf := &Configuration{}
+		conf.Task("compile")
+		conf.Function("setup")
+		conf.Function("run tests")
+		tasks, err := conf.Shard("ubuntu", shardTemplate(), ShardOptions{
+			Tests:  []string{"a", "b", "c", "d", "e"},
+			Shards: 2,
+		})
+		require(t, err == nil, errString(err))
+		require(t, len(tasks) == 2)
+
+		assert(t, tasks[0].Name == "test_0")
+		assert(t, tasks[1].Name == "test_1")
+		assert(t, len(conf.Tasks) == 3)
+		assert(t, tasks[0].Dependencies[0].Name == "compile")
+
+		vars := tasks[0].Commands[1].Vars
+		assert(t, vars[ShardTestsVar] == "a c e", vars[ShardTestsVar])
+		assert(t, vars[ShardIndexVar] == "0")
+		assert(t, vars[ShardCountVar] == "2")
+		assert(t, vars["suite"] == "unit")
+		assert(t, tasks[1].Commands[1].Vars[ShardTestsVar] == "b d")
+		assert(t, tasks[1].Commands[0].Vars[ShardIndexVar] == "1")
+
+		v := conf.Variant("ubuntu")
+		require(t, len(v.DisplayTaskSpecs) == 1)
+		assert(t, v.DisplayTaskSpecs[0].Name == "test")
+		assert(t, strings.Join(v.DisplayTaskSpecs[0].Components, ",") == "test_0,test_1")
+		assert(t, strings.Join(conf.variantTasks(v), ",") == "test_0,test_1")
+
+		assert(t, conf.Validate() == nil, errString(conf.Validate()))
+	})
+	t.Run("TemplateUnchanged", func(t *testing.T) {
+		conf := &Configuration{}
+		tmpl := shardTemplate()
+		_, err := conf.Shard("ubuntu", tmpl, ShardOptions{Tests: []string{"a"}, Shards: 1})
+		require(t, err == nil, errString(err))
+		assert(t, tmpl.Name == "test")
+		assert(t, len(tmpl.Commands[1].Vars) == 1)
+		assert(t, tmpl.Commands[0].Vars == nil)
+	})
+	t.Run("Padding", func(t *testing.T) {
+		tests := make([]string, 12)
+		for idx := range tests {
+			tests[idx] = string(rune('a' + idx))
+		}
+		conf := &Configuration{}
+		tasks, err := conf.Shard("ubuntu", shardTemplate(), ShardOptions{Tests: tests, Shards: 11})
+		require(t, err == nil, errString(err))
+		require(t, len(tasks) == 11)
+		assert(t, tasks[0].Name == "test_00")
+		assert(t, tasks[10].Name == "test_10")
+	})
+	t.Run("MoreShardsThanTests", func(t *testing.T) {
+		conf := &Configuration{}
+		tasks, err := conf.Shard("ubuntu", shardTemplate(), ShardOptions{Tests: []string{"a", "b"}, Shards: 5})
+		require(t, err == nil, errString(err))
+		assert(t, len(tasks) == 2)
+	})
+	t.Run("TargetDuration", func(t *testing.T) {
+		conf := &Configuration{}
+		tasks, err := conf.Shard("ubuntu", shardTemplate(), ShardOptions{
+			Tests:          []string{"slow", "medium", "fast", "quick", "unknown"},
+			TargetDuration: 10 * time.Minute,
+			Timings: map[string]time.Duration{
+				"slow":   9 * time.Minute,
+				"medium": 5 * time.Minute,
+				"fast":   3 * time.Minute,
+				"quick":  3 * time.Minute,
+			},
+		})
+		require(t, err == nil, errString(err))
+		require(t, len(tasks) == 3)
+		assert(t, tasks[0].Commands[0].Vars[ShardTestsVar] == "slow")
+		assert(t, tasks[1].Commands[0].Vars[ShardTestsVar] == "medium fast", tasks[1].Commands[0].Vars[ShardTestsVar])
+		assert(t, tasks[2].Commands[0].Vars[ShardTestsVar] == "quick unknown", tasks[2].Commands[0].Vars[ShardTestsVar])
+	})
+	t.Run("ZeroTimings", func(t *testing.T) {
+		conf := &Configuration{}
+		tasks, err := conf.Shard("ubuntu", shardTemplate(), ShardOptions{
+			Tests:   []string{"a", "b", "c", "d", "e"},
+			Shards:  2,
+			Timings: map[string]time.Duration{"a": 0, "b": 0, "c": 0, "d": 0, "e": 0},
+		})
+		require(t, err == nil, errString(err))
+		require(t, len(tasks) == 2)
+		assert(t, tasks[0].Commands[0].Vars[ShardTestsVar] == "a c e", tasks[0].Commands[0].Vars[ShardTestsVar])
+		assert(t, tasks[1].Commands[0].Vars[ShardTestsVar] == "b d", tasks[1].Commands[0].Vars[ShardTestsVar])
+	})
+	t.Run("Errors", func(t *testing.T) {
+		cases := map[string]struct {
+			template *Task
+			opts     ShardOptions
+		}{
+			"NoTemplate":     {opts: ShardOptions{Tests: []string{"a"}, Shards: 1}},
+			"UnnamedTask":    {template: &Task{}, opts: ShardOptions{Tests: []string{"a"}, Shards: 1}},
+			"NoFunctions":    {template: (&Task{Name: "test"}).Command(CmdExec{Binary: "true"}), opts: ShardOptions{Tests: []string{"a"}, Shards: 1}},
+			"NoTests":        {template: shardTemplate(), opts: ShardOptions{Shards: 1}},
+			"NegativeShards": {template: shardTemplate(), opts: ShardOptions{Tests: []string{"a"}, Shards: -1}},
+			"DuplicateTests": {template: shardTemplate(), opts: ShardOptions{Tests: []string{"a", "b", "a"}, Shards: 2}},
+			"NoCount":        {template: shardTemplate(), opts: ShardOptions{Tests: []string{"a"}}},
+			"NoTimings":      {template: shardTemplate(), opts: ShardOptions{Tests: []string{"a"}, TargetDuration: time.Minute}},
+			"NameCollision":  {template: (&Task{Name: "compile"}).Function("run"), opts: ShardOptions{Tests: []string{"a"}, Shards: 1}},
+			"ShardCollision": {template: (&Task{Name: "lint"}).Function("run"), opts: ShardOptions{Tests: []string{"a"}, Shards: 1}},
+		}
+		for name, test := range cases {
+			t.Run(name, func(t *testing.T) {
+				conf := &Configuration{}
+				conf.Task("compile")
+				conf.Task("lint_0")
+				tasks, err := conf.Shard("ubuntu", test.template, test.opts)
+				assert(t, err != nil)
+				assert(t, tasks == nil)
+				assert(t, len(conf.Tasks) == 2)
+				assert(t, len(conf.Variants) == 0)
+			})
+		}
+	})
+}
+
+func TestReadSelectedTests(t *testing.T) {
+	dir := t.TempDir()
+	write := func(t *testing.T, content string) string {
+		path := filepath.Join(dir, t.Name()[strings.LastIndex(t.Name(), "/")+1:]+".json")
+		require(t, os.WriteFile(path, []byte(content), 0600) == nil)
+		return path
+	}
+
+	t.Run("Names", func(t *testing.T) {
+		tests, err := ReadSelectedTests(write(t, `{"tests": ["a", "b"]}`))
+		require(t, err == nil, errString(err))
+		assert(t, strings.Join(tests, ",") == "a,b")
+	})
+	t.Run("Objects", func(t *testing.T) {
+		tests, err := ReadSelectedTests(write(t, `{"tests": [{"name": "a"}, "b"]}`))
+		require(t, err == nil, errString(err))
+		assert(t, strings.Join(tests, ",") == "a,b")
+	})
+	t.Run("Empty", func(t *testing.T) {
+		tests, err := ReadSelectedTests(write(t, `{}`))
+		require(t, err == nil, errString(err))
+		assert(t, len(tests) == 0)
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := ReadSelectedTests(write(t, `{"tests": [1]}`))
+		assert(t, err != nil)
+		_, err = ReadSelectedTests(write(t, `not json`))
+		assert(t, err != nil)
+		_, err = ReadSelectedTests(filepath.Join(dir, "missing.json"))
+		assert(t, err != nil)
+	})
+}
@@ -0,0 +1,440 @@
+package shrub
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Split partitions the configuration into several configurations,
+// each of which produces a generate.tasks payload (as written by
+// WriteGenerateTasksFile) of at most maxBytes bytes, so that they can
+// be passed together in the files list of a single generate.tasks
+// command.
+//
+// Tasks that share a task group or a display task are always kept
+// together, along with the task group definition and the portions of
+// every build variant that list them. Nothing is defined in more than
+// one configuration: each function is defined in the first
+// configuration with a command that calls it, and the settings of each
+// build variant (its display name, run_on, expansions and so on) are
+// only set in the first configuration, while the others only list the
+// variant's name, tasks and display tasks. Anything that cannot be
+// attributed to a particular task (unreferenced functions, tag
+// selectors, variants without tasks, etc.) is also placed in the first
+// configuration. The configurations therefore refer to each other, and
+// are only valid as fragments (see ValidateFragment).
+//
+// Split returns an error if the configuration sets project settings,
+// which generate.tasks cannot set (see WriteGenerateTasksFile), or if
+// any indivisible portion of the configuration is larger than
+// maxBytes.
+//
+// The resulting configurations share tasks, task groups and functions
+// with the original configuration rather than copying them.
+func (c *Configuration) Split(maxBytes int) ([]*Configuration, error) {
+	if maxBytes <= 0 {
+		return nil, errors.New("maximum payload size must be positive")
+	}
+	if c.hasProjectSettings() {
+		return nil, errGenerateProjectSettings
+	}
+
+	payload, err := c.generateTasksPayload()
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) <= maxBytes {
+		return []*Configuration{c}, nil
+	}
+
+	s := newSplitter(c)
+	empty, err := s.size(&splitBin{})
+	if err != nil {
+		return nil, err
+	}
+	current := &splitBin{first: true}
+	size, err := s.size(current)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxBytes {
+		return nil, fmt.Errorf("configuration elements not associated with any task cannot fit in %d bytes", maxBytes)
+	}
+
+	// Each unit is serialized on its own once, and a bin's size is
+	// estimated from the sizes of its units, which is never less than
+	// the size of the combined payload, rather than serializing the
+	// whole bin again as each unit is added.
+	out := []*Configuration{}
+	for _, u := range s.units() {
+		alone, err := s.size((&splitBin{}).add(u))
+		if err != nil {
+			return nil, err
+		}
+		if alone > maxBytes {
+			return nil, fmt.Errorf("tasks [%s] cannot fit in %d bytes", strings.Join(u, ", "), maxBytes)
+		}
+
+		// Adding a unit to a bin adds at most a separating comma to
+		// the unit's own payload, less the enclosing braces.
+		marginal := alone - empty + 1
+		if size+marginal <= maxBytes {
+			current.add(u)
+			size += marginal
+			continue
+		}
+
+		if part := s.configuration(current); !current.empty() || !part.isEmpty() {
+			out = append(out, s.define(part))
+		}
+		current = (&splitBin{first: len(out) == 0}).add(u)
+		if size, err = s.size(current); err != nil {
+			return nil, err
+		} else if size > maxBytes {
+			return nil, fmt.Errorf("tasks [%s] cannot fit in %d bytes", strings.Join(u, ", "), maxBytes)
+		}
+	}
+
+	return append(out, s.configuration(current)), nil
+}
+
+// splitUnit is a set of tasks and task groups that must be generated
+// together.
+type splitUnit []string
+
+// splitBin tracks the tasks and task groups assigned to one of the
+// output configurations.
+type splitBin struct {
+	first bool
+	units int
+	names map[string]bool
+}
+
+func (b *splitBin) empty() bool { return b.units == 0 }
+
+// add adds the unit to the bin.
+func (b *splitBin) add(u splitUnit) *splitBin {
+	if b.names == nil {
+		b.names = map[string]bool{}
+	}
+	for _, name := range u {
+		b.names[name] = true
+	}
+	b.units++
+	return b
+}
+
+func (c *Configuration) isEmpty() bool {
+	return len(c.Functions) == 0 && len(c.Tasks) == 0 && len(c.Groups) == 0 && len(c.Variants) == 0 && !c.hasProjectSettings()
+}
+
+// splitter holds the information about a configuration that is needed
+// to build each of the configurations that it is split into.
+type splitter struct {
+	conf *Configuration
+	// known contains the names of every task and task group.
+	known map[string]bool
+	// orphans contains the names of functions that are not called by
+	// any command.
+	orphans []string
+	// defined contains the names of the functions defined by the
+	// configurations built so far, which later configurations omit.
+	defined map[string]bool
+	// tasks and groups map the name of each task and task group to its
+	// position in the configuration.
+	tasks  map[string][]int
+	groups map[string][]int
+	// specs and displayTasks map, for each build variant, the name of
+	// the task or task group that owns each task spec and display task
+	// (or "" if it is not owned by any) to its position in the variant.
+	specs        []map[string][]int
+	displayTasks []map[string][]int
+}
+
+func newSplitter(c *Configuration) *splitter {
+	s := &splitter{
+		conf:    c,
+		defined: map[string]bool{},
+		known:   map[string]bool{},
+		tasks:   map[string][]int{},
+		groups:  map[string][]int{},
+	}
+	for idx, t := range c.Tasks {
+		if t != nil {
+			s.known[t.Name] = true
+			s.tasks[t.Name] = append(s.tasks[t.Name], idx)
+		}
+	}
+	for idx, g := range c.Groups {
+		if g != nil {
+			s.known[g.GroupName] = true
+			s.groups[g.GroupName] = append(s.groups[g.GroupName], idx)
+		}
+	}
+
+	for _, v := range c.Variants {
+		specs, displayTasks := map[string][]int{}, map[string][]int{}
+		if v != nil {
+			for idx, spec := range v.TaskSpecs {
+				owner := s.owner(spec.Name)
+				specs[owner] = append(specs[owner], idx)
+			}
+			for idx, dt := range v.DisplayTaskSpecs {
+				owner := ""
+				for _, name := range dt.Components {
+					if s.known[name] {
+						owner = name
+						break
+					}
+				}
+				displayTasks[owner] = append(displayTasks[owner], idx)
+			}
+		}
+		s.specs = append(s.specs, specs)
+		s.displayTasks = append(s.displayTasks, displayTasks)
+	}
+
+	called := map[string]bool{}
+	for _, seq := range c.commandSequences() {
+		for _, cmd := range *seq.commands {
+			if cmd != nil && cmd.FunctionName != "" {
+				called[cmd.FunctionName] = true
+			}
+		}
+	}
+	for name := range c.Functions {
+		if !called[name] {
+			s.orphans = append(s.orphans, name)
+		}
+	}
+
+	return s
+}
+
+// owner returns the name if it is a known task or task group, and ""
+// otherwise.
+func (s *splitter) owner(name string) string {
+	if s.known[name] {
+		return name
+	}
+	return ""
+}
+
+// units groups the names of tasks and task groups into the smallest
+// sets that must be kept in the same configuration, in the order in
+// which they are first defined.
+func (s *splitter) units() []splitUnit {
+	c := s.conf
+
+	parent := map[string]string{}
+	order := []string{}
+	add := func(name string) {
+		if _, ok := parent[name]; !ok {
+			parent[name] = name
+			order = append(order, name)
+		}
+	}
+	var find func(string) string
+	find = func(name string) string {
+		if parent[name] != name {
+			parent[name] = find(parent[name])
+		}
+		return parent[name]
+	}
+	union := func(a, b string) {
+		if ra, rb := find(a), find(b); ra != rb {
+			parent[rb] = ra
+		}
+	}
+
+	for _, t := range c.Tasks {
+		if t != nil {
+			add(t.Name)
+		}
+	}
+	for _, g := range c.Groups {
+		if g == nil {
+			continue
+		}
+		add(g.GroupName)
+		for _, name := range g.Tasks {
+			if c.findTask(name) != nil {
+				union(g.GroupName, name)
+			}
+		}
+	}
+	for _, v := range c.Variants {
+		if v == nil {
+			continue
+		}
+		for _, dt := range v.DisplayTaskSpecs {
+			var first string
+			for _, name := range dt.Components {
+				if _, ok := parent[name]; !ok {
+					continue
+				}
+				if first == "" {
+					first = name
+					continue
+				}
+				union(first, name)
+			}
+		}
+	}
+
+	index := map[string]int{}
+	units := []splitUnit{}
+	for _, name := range order {
+		root := find(name)
+		idx, ok := index[root]
+		if !ok {
+			idx = len(units)
+			index[root] = idx
+			units = append(units, splitUnit{})
+		}
+		units[idx] = append(units[idx], name)
+	}
+
+	return units
+}
+
+// size returns the size of the generate.tasks payload of the bin's
+// configuration.
+func (s *splitter) size(bin *splitBin) (int, error) {
+	payload, err := s.configuration(bin).generateTasksPayload()
+	if err != nil {
+		return 0, err
+	}
+	return len(payload), nil
+}
+
+// define records the functions defined by a completed configuration,
+// so that the configurations that follow it do not define them again.
+func (s *splitter) define(part *Configuration) *Configuration {
+	for name := range part.Functions {
+		s.defined[name] = true
+	}
+	return part
+}
+
+// configuration builds the configuration for the bin. It only visits
+// the parts of the configuration that belong to the bin, so that the
+// configurations of small bins are cheap to build.
+func (s *splitter) configuration(bin *splitBin) *Configuration {
+	c := s.conf
+	out := &Configuration{}
+
+	// Anything that does not refer to a known task or group goes in
+	// the first configuration.
+	owners := make([]string, 0, len(bin.names)+1)
+	for name := range bin.names {
+		owners = append(owners, name)
+	}
+	if bin.first {
+		owners = append(owners, "")
+	}
+	positions := func(index map[string][]int) []int {
+		out := []int{}
+		for _, name := range owners {
+			out = append(out, index[name]...)
+		}
+		sort.Ints(out)
+		return out
+	}
+
+	seqs := []CommandSequence{}
+	for _, idx := range positions(s.tasks) {
+		t := c.Tasks[idx]
+		out.Tasks = append(out.Tasks, t)
+		seqs = append(seqs, t.Commands)
+	}
+	for _, idx := range positions(s.groups) {
+		g := c.Groups[idx]
+		out.Groups = append(out.Groups, g)
+		seqs = append(seqs, g.SetupGroup, g.SetupTask, g.TeardownTask, g.TeardownGroup, g.Timeout)
+	}
+
+	if bin.first {
+		for _, name := range s.orphans {
+			seqs = append(seqs, CommandSequence{{FunctionName: name}})
+		}
+	}
+	for vidx, v := range c.Variants {
+		if v == nil {
+			continue
+		}
+		for _, idx := range positions(s.specs[vidx]) {
+			if g := v.TaskSpecs[idx].TaskGroup; g != nil {
+				seqs = append(seqs, g.SetupGroup, g.SetupTask, g.TeardownTask, g.TeardownGroup, g.Timeout)
+			}
+		}
+	}
+	for name := range c.functionsCalledBy(seqs...) {
+		if s.defined[name] {
+			continue
+		}
+		if out.Functions == nil {
+			out.Functions = map[string]*CommandSequence{}
+		}
+		out.Functions[name] = c.Functions[name]
+	}
+
+	for vidx, v := range c.Variants {
+		if v == nil {
+			continue
+		}
+
+		var specs []TaskSpec
+		for _, idx := range positions(s.specs[vidx]) {
+			specs = append(specs, v.TaskSpecs[idx])
+		}
+
+		var displayTasks []DisplayTaskDefinition
+		for _, idx := range positions(s.displayTasks[vidx]) {
+			displayTasks = append(displayTasks, v.DisplayTaskSpecs[idx])
+		}
+
+		var variant Variant
+		switch {
+		case bin.first:
+			variant = *v
+		case len(specs) == 0 && len(displayTasks) == 0:
+			continue
+		default:
+			variant.BuildName = v.BuildName
+		}
+		variant.TaskSpecs = specs
+		variant.DisplayTaskSpecs = displayTasks
+		out.Variants = append(out.Variants, &variant)
+	}
+
+	return out
+}
+
+// functionsCalledBy returns the names of the defined functions called
+// from the sequences, including functions called from within those
+// functions.
+func (c *Configuration) functionsCalledBy(seqs ...CommandSequence) map[string]bool {
+	out := map[string]bool{}
+	queue := append([]CommandSequence{}, seqs...)
+	for len(queue) > 0 {
+		seq := queue[0]
+		queue = queue[1:]
+		for _, cmd := range seq {
+			if cmd == nil || cmd.FunctionName == "" || out[cmd.FunctionName] {
+				continue
+			}
+			fn, ok := c.Functions[cmd.FunctionName]
+			if !ok {
+				continue
+			}
+			out[cmd.FunctionName] = true
+			if fn != nil {
+				queue = append(queue, *fn)
+			}
+		}
+	}
+	return out
+}
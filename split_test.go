@@ -0,0 +1,158 @@
+package shrub
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigurationSplit(t *testing.T) {
+	cases := map[string]func(*testing.T, *Configuration){
+		"FitsInOne": func(t *testing.T, conf *Configuration) {
+			conf.Task("compile")
+			conf.Variant("ubuntu").AddTasks("compile")
+
+			out, err := conf.Split(1 << 20)
+			require(t, err == nil, errString(err))
+			require(t, len(out) == 1)
+			assert(t, out[0] == conf)
+		},
+		"InvalidSize": func(t *testing.T, conf *Configuration) {
+			conf.Task("compile")
+
+			out, err := conf.Split(0)
+			assert(t, err != nil)
+			assert(t, out == nil)
+		},
+		"TooSmall": func(t *testing.T, conf *Configuration) {
+			conf.Task("compile").Command(CmdExecShell{Script: strings.Repeat("echo filler; ", 10)})
+			conf.Variant("ubuntu").AddTasks("compile")
+
+			out, err := conf.Split(100)
+			assert(t, err != nil)
+			assert(t, out == nil)
+		},
+		"Partitions": func(t *testing.T, conf *Configuration) {
+			conf.Function("setup").Command().Command("git.get_project").Param("directory", "src")
+			conf.Function("unused").Command().Command("shell.exec").Param("script", "true")
+			conf.Function("group-setup").Command().Command("shell.exec").Param("script", "setup")
+
+			ubuntu := conf.Variant("ubuntu").RunOn("ubuntu2204-small").Expansion("GOROOT", "/opt/go")
+			for i := 0; i < 20; i++ {
+				name := fmt.Sprintf("test-%02d", i)
+				conf.Task(name).Function("setup").
+					Command(CmdExecShell{Script: strings.Repeat("echo filler; ", 10)})
+				if name != "test-03" && name != "test-15" {
+					ubuntu.AddTasks(name)
+				}
+			}
+			conf.Task("test-07").Tag("lint")
+			conf.TaskGroup("group").Task("test-03", "test-15").SetupGroup.Append(&CommandDefinition{FunctionName: "group-setup"})
+			ubuntu.AddTasks("group", ".lint")
+			ubuntu.DisplayTasks(DisplayTaskDefinition{Name: "shards", Components: []string{"test-01", "test-19"}})
+			conf.Variant("empty").DisplayName("Nothing here")
+
+			require(t, conf.Validate() == nil, errString(conf.Validate()))
+			payload, err := conf.generateTasksPayload()
+			require(t, err == nil, errString(err))
+
+			max := len(payload) / 3
+			out, err := conf.Split(max)
+			require(t, err == nil, errString(err))
+			require(t, len(out) > 2, "splits into multiple configurations")
+
+			tasks := map[string]int{}
+			specs := map[string]int{}
+			functions := map[string]int{}
+			for idx, part := range out {
+				data, err := part.generateTasksPayload()
+				require(t, err == nil, errString(err))
+				assert(t, len(data) <= max, fmt.Sprint("part ", idx, " is ", len(data), " bytes"))
+				assert(t, part.ValidateFragment() == nil, errString(part.ValidateFragment()))
+				path := filepath.Join(t.TempDir(), "generated.json")
+				assert(t, part.WriteGenerateTasksFile(path) == nil, errString(part.WriteGenerateTasksFile(path)))
+
+				for _, task := range part.Tasks {
+					tasks[task.Name]++
+				}
+				for name := range part.Functions {
+					functions[name]++
+				}
+				for _, v := range part.Variants {
+					if v.BuildName == "ubuntu" && idx > 0 {
+						assert(t, v.DistroRunOn == nil && v.Expansions == nil, "variant settings are only in the first configuration")
+					}
+					for _, spec := range v.TaskSpecs {
+						specs[v.BuildName+"/"+spec.Name]++
+					}
+				}
+			}
+
+			assert(t, len(tasks) == len(conf.Tasks), "every task is generated")
+			for name, count := range tasks {
+				assert(t, count == 1, name, "is generated once")
+			}
+			assert(t, len(specs) == len(ubuntu.TaskSpecs), "every task spec is generated")
+			for name, count := range specs {
+				assert(t, count == 1, name, "is listed once")
+			}
+			assert(t, len(functions) == len(conf.Functions), "every function is generated")
+			for name, count := range functions {
+				assert(t, count == 1, name, "is defined once")
+			}
+
+			first := out[0]
+			assert(t, first.findVariant("ubuntu").DistroRunOn[0] == "ubuntu2204-small", "variant settings are retained")
+			assert(t, first.findVariant("ubuntu").Expansions["GOROOT"] == "/opt/go", "variant settings are retained")
+			_, ok := first.Functions["unused"]
+			assert(t, ok, "unreferenced functions are in the first configuration")
+			assert(t, first.findVariant("empty") != nil, "variants without tasks are in the first configuration")
+			hasSelector := false
+			for _, spec := range first.findVariant("ubuntu").TaskSpecs {
+				hasSelector = hasSelector || spec.Name == ".lint"
+			}
+			assert(t, hasSelector, "selectors are in the first configuration")
+
+			for _, part := range out {
+				if part.findGroup("group") != nil {
+					assert(t, part.findTask("test-03") != nil && part.findTask("test-15") != nil, "group members are together")
+				}
+				if part.findTask("test-01") != nil || part.findTask("test-19") != nil {
+					assert(t, part.findTask("test-01") != nil && part.findTask("test-19") != nil, "display task members are together")
+					require(t, len(part.findVariant("ubuntu").DisplayTaskSpecs) == 1, "display task is included")
+				}
+			}
+		},
+		"ProjectSettings": func(t *testing.T, conf *Configuration) {
+			conf.Task("compile")
+			conf.Variant("ubuntu").AddTasks("compile")
+			conf.SetCommandType("test")
+
+			out, err := conf.Split(1 << 20)
+			assert(t, err != nil, "project settings cannot be generated")
+			assert(t, out == nil)
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			test(t, &Configuration{})
+		})
+	}
+}
+
+func BenchmarkConfigurationSplit(b *testing.B) {
+	conf := &Configuration{}
+	for i := 0; i < 2000; i++ {
+		name := fmt.Sprintf("test-%04d", i)
+		conf.Task(name).Command(CmdExecShell{Script: strings.Repeat("echo filler; ", 10)})
+		conf.Variant("ubuntu").AddTasks(name)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := conf.Split(64 << 10); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package shrub
 
+import "fmt"
+
 // Task represents a single new task to generate.
 type Task struct {
 	Name               string           `json:"name" yaml:"name"`
@@ -7,7 +9,7 @@ type Task struct {
 	Commands           CommandSequence  `json:"commands" yaml:"commands"`
 	Tags               []string         `json:"tags,omitempty" yaml:"tags,omitempty"`
 	DistroRunOn        []string         `json:"run_on,omitempty" yaml:"run_on,omitempty"`
-	PriorityOverride   int              `json:"priority,omitempty" yaml:"priority_override,omitempty"`
+	PriorityOverride   int              `json:"priority,omitempty" yaml:"priority,omitempty"`
 	ExecTimeoutSecs    int              `json:"exec_timeout_secs,omitempty" yaml:"exec_timeout_secs,omitempty"`
 	IsPatchable        *bool            `json:"patchable,omitempty" yaml:"patchable,omitempty"`
 	IsPatchOnly        *bool            `json:"patch_only,omitempty" yaml:"patch_only,omitempty"`
@@ -17,6 +19,8 @@ type Task struct {
 	Disable            *bool            `json:"disable,omitempty" yaml:"disable,omitempty"`
 	CanStepback        *bool            `json:"stepback,omitempty" yaml:"stepback,omitempty"`
 	MustHaveResults    *bool            `json:"must_have_test_results,omitempty" yaml:"must_have_test_results,omitempty"`
+
+	collector *buildCollector
 }
 
 type TaskDependency struct {
@@ -53,12 +57,19 @@ func (td *TaskDependency) SetOmitGeneratedTasks(val bool) *TaskDependency {
 }
 
 func (t *Task) Command(cmds ...Command) *Task {
-	for _, c := range cmds {
-		if err := c.Validate(); err != nil {
-			panic(err)
+	start := len(t.Commands)
+	for idx, c := range cmds {
+		def, err := ResolveCommand(c)
+		if err != nil {
+			t.collector.fail(BuildFailure{
+				Path:    fmt.Sprintf("tasks[%s].commands[%d]", t.Name, start+idx),
+				Command: commandName(c),
+				Cause:   err,
+			})
+			continue
 		}
 
-		t.Commands = append(t.Commands, c.Resolve())
+		t.Commands = append(t.Commands, def)
 	}
 
 	return t
@@ -169,6 +180,8 @@ type TaskGroup struct {
 	TeardownGroupTimeoutSecs int             `json:"teardown_group_timeout_secs,omitempty" yaml:"teardown_group_timeout_secs,omitempty"`
 	Timeout                  CommandSequence `json:"timeout,omitempty" yaml:"timeout,omitempty"`
 	CallbackTimeoutSecs      int             `json:"callback_timeout_secs,omitempty" yaml:"callback_timeout_secs,omitempty"`
+
+	collector *buildCollector
 }
 
 func (g *TaskGroup) Name(id string) *TaskGroup {
@@ -187,12 +200,7 @@ func (g *TaskGroup) SetShareProcesses(val bool) *TaskGroup {
 }
 
 func (g *TaskGroup) SetupGroupCommand(cmds ...Command) *TaskGroup {
-	for _, c := range cmds {
-		if err := c.Validate(); err != nil {
-			panic(err)
-		}
-		g.SetupGroup = append(g.SetupGroup, c.Resolve())
-	}
+	g.addCommands(&g.SetupGroup, "setup_group", cmds)
 	return g
 }
 
@@ -207,12 +215,7 @@ func (g *TaskGroup) SetSetupGroupTimeoutSecs(timeoutSecs int) *TaskGroup {
 }
 
 func (g *TaskGroup) SetupTaskCommand(cmds ...Command) *TaskGroup {
-	for _, c := range cmds {
-		if err := c.Validate(); err != nil {
-			panic(err)
-		}
-		g.SetupTask = append(g.SetupTask, c.Resolve())
-	}
+	g.addCommands(&g.SetupTask, "setup_task", cmds)
 	return g
 }
 
@@ -232,12 +235,7 @@ func (g *TaskGroup) Task(id ...string) *TaskGroup {
 }
 
 func (g *TaskGroup) TeardownTaskCommand(cmds ...Command) *TaskGroup {
-	for _, c := range cmds {
-		if err := c.Validate(); err != nil {
-			panic(err)
-		}
-		g.TeardownTask = append(g.TeardownTask, c.Resolve())
-	}
+	g.addCommands(&g.TeardownTask, "teardown_task", cmds)
 	return g
 }
 
@@ -252,12 +250,7 @@ func (g *TaskGroup) SetTeardownTaskTimeoutSecs(timeoutSecs int) *TaskGroup {
 }
 
 func (g *TaskGroup) TeardownGroupCommand(cmds ...Command) *TaskGroup {
-	for _, c := range cmds {
-		if err := c.Validate(); err != nil {
-			panic(err)
-		}
-		g.TeardownGroup = append(g.TeardownGroup, c.Resolve())
-	}
+	g.addCommands(&g.TeardownGroup, "teardown_group", cmds)
 	return g
 }
 
@@ -267,12 +260,7 @@ func (g *TaskGroup) SetTeardownGroupTimeoutSecs(timeoutSecs int) *TaskGroup {
 }
 
 func (g *TaskGroup) TimeoutCommand(cmds ...Command) *TaskGroup {
-	for _, c := range cmds {
-		if err := c.Validate(); err != nil {
-			panic(err)
-		}
-		g.Timeout = append(g.Timeout, c.Resolve())
-	}
+	g.addCommands(&g.Timeout, "timeout", cmds)
 	return g
 }
 
@@ -285,3 +273,20 @@ func (g *TaskGroup) Tag(tags ...string) *TaskGroup {
 	g.Tags = append(g.Tags, tags...)
 	return g
 }
+
+func (g *TaskGroup) addCommands(seq *CommandSequence, hook string, cmds []Command) {
+	start := len(*seq)
+	for idx, c := range cmds {
+		def, err := ResolveCommand(c)
+		if err != nil {
+			g.collector.fail(BuildFailure{
+				Path:    fmt.Sprintf("task_groups[%s].%s[%d]", g.GroupName, hook, start+idx),
+				Command: commandName(c),
+				Cause:   err,
+			})
+			continue
+		}
+
+		*seq = append(*seq, def)
+	}
+}
@@ -123,7 +123,7 @@ func TestTaskBuilder(t *testing.T) {
 			require(t, len(task.Commands) == 0)
 		},
 		"CommandExtenderWithOneValidCommand": func(t *testing.T, task *Task) {
-			t2 := task.Command(CmdExec{})
+			t2 := task.Command(CmdExec{Binary: "true"})
 			assert(t, task == t2, "chainable")
 			require(t, len(task.Commands) == 1)
 		},
@@ -133,7 +133,7 @@ func TestTaskBuilder(t *testing.T) {
 			assert(t, task == t2, "chainable")
 		},
 		"CommandExtenderWithManyValidCommands": func(t *testing.T, task *Task) {
-			t2 := task.Command(CmdExec{}, CmdExec{}).Command(CmdExec{})
+			t2 := task.Command(CmdExec{Binary: "true"}, CmdExec{Binary: "true"}).Command(CmdExec{Binary: "true"})
 			assert(t, task == t2, "chainable")
 			require(t, len(task.Commands) == 3)
 		},
@@ -289,11 +289,11 @@ func TestTaskGroup(t *testing.T) {
 		assert(t, len(g.SetupGroup) == 0, "default value")
 		g.SetupGroupCommand()
 		assert(t, len(g.SetupGroup) == 0, "noop")
-		g.SetupGroupCommand(CmdExecShell{})
+		g.SetupGroupCommand(CmdExecShell{Script: "true"})
 		assert(t, len(g.SetupGroup) == 1, "first command")
-		g.SetupGroupCommand(CmdExec{})
+		g.SetupGroupCommand(CmdExec{Binary: "true"})
 		assert(t, len(g.SetupGroup) == 2, "no deduplicate")
-		g.SetupGroupCommand(CmdExecShell{}, CmdExec{})
+		g.SetupGroupCommand(CmdExecShell{Script: "true"}, CmdExec{Binary: "true"})
 		assert(t, len(g.SetupGroup) == 4, "multi add")
 		defer expect(t, "adding invalid command should panic")
 		g.SetupGroupCommand(CmdS3Put{})
@@ -319,11 +319,11 @@ func TestTaskGroup(t *testing.T) {
 		assert(t, len(g.SetupTask) == 0, "default value")
 		g.SetupTaskCommand()
 		assert(t, len(g.SetupTask) == 0, "noop")
-		g.SetupTaskCommand(CmdExecShell{})
+		g.SetupTaskCommand(CmdExecShell{Script: "true"})
 		assert(t, len(g.SetupTask) == 1, "first command")
-		g.SetupTaskCommand(CmdExec{})
+		g.SetupTaskCommand(CmdExec{Binary: "true"})
 		assert(t, len(g.SetupTask) == 2, "no deduplicate")
-		g.SetupTaskCommand(CmdExecShell{}, CmdExec{})
+		g.SetupTaskCommand(CmdExecShell{Script: "true"}, CmdExec{Binary: "true"})
 		assert(t, len(g.SetupTask) == 4, "multi add")
 		defer expect(t, "adding invalid command should panic")
 		g.SetupTaskCommand(CmdS3Put{})
@@ -349,11 +349,11 @@ func TestTaskGroup(t *testing.T) {
 		assert(t, len(g.TeardownTask) == 0, "default value")
 		g.TeardownTaskCommand()
 		assert(t, len(g.TeardownTask) == 0, "noop")
-		g.TeardownTaskCommand(CmdExecShell{})
+		g.TeardownTaskCommand(CmdExecShell{Script: "true"})
 		assert(t, len(g.TeardownTask) == 1, "first command")
-		g.TeardownTaskCommand(CmdExec{})
+		g.TeardownTaskCommand(CmdExec{Binary: "true"})
 		assert(t, len(g.TeardownTask) == 2, "no deduplicate")
-		g.TeardownTaskCommand(CmdExecShell{}, CmdExec{})
+		g.TeardownTaskCommand(CmdExecShell{Script: "true"}, CmdExec{Binary: "true"})
 		assert(t, len(g.TeardownTask) == 4, "multi add")
 		defer expect(t, "adding invalid command should panic")
 		g.TeardownTaskCommand(CmdS3Put{})
@@ -379,11 +379,11 @@ func TestTaskGroup(t *testing.T) {
 		assert(t, len(g.TeardownGroup) == 0, "default value")
 		g.TeardownGroupCommand()
 		assert(t, len(g.TeardownGroup) == 0, "noop")
-		g.TeardownGroupCommand(CmdExecShell{})
+		g.TeardownGroupCommand(CmdExecShell{Script: "true"})
 		assert(t, len(g.TeardownGroup) == 1, "first command")
-		g.TeardownGroupCommand(CmdExec{})
+		g.TeardownGroupCommand(CmdExec{Binary: "true"})
 		assert(t, len(g.TeardownGroup) == 2, "no deduplicate")
-		g.TeardownGroupCommand(CmdExecShell{}, CmdExec{})
+		g.TeardownGroupCommand(CmdExecShell{Script: "true"}, CmdExec{Binary: "true"})
 		assert(t, len(g.TeardownGroup) == 4, "multi add")
 		defer expect(t, "adding invalid command should panic")
 		g.TeardownGroupCommand(CmdS3Put{})
@@ -401,11 +401,11 @@ func TestTaskGroup(t *testing.T) {
 		assert(t, len(g.Timeout) == 0, "default value")
 		g.TimeoutCommand()
 		assert(t, len(g.Timeout) == 0, "noop")
-		g.TimeoutCommand(CmdExecShell{})
+		g.TimeoutCommand(CmdExecShell{Script: "true"})
 		assert(t, len(g.Timeout) == 1, "first command")
-		g.TimeoutCommand(CmdExec{})
+		g.TimeoutCommand(CmdExec{Binary: "true"})
 		assert(t, len(g.Timeout) == 2, "no deduplicate")
-		g.TimeoutCommand(CmdExecShell{}, CmdExec{})
+		g.TimeoutCommand(CmdExecShell{Script: "true"}, CmdExec{Binary: "true"})
 		assert(t, len(g.Timeout) == 4, "multi add")
 		defer expect(t, "adding invalid command should panic")
 		g.TimeoutCommand(CmdS3Put{})
@@ -37,3 +37,10 @@ func expect(t *testing.T, msgElems ...string) {
 	}
 
 }
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,399 @@
+package shrub
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Validate checks the configuration for internal consistency: that
+// every task, task group, variant, function and module is uniquely
+// named, that every reference between them (task specs, task group
+// members, display task components, dependencies, function calls and
+// variant modules) resolves to something defined in the configuration,
+// that every task selector matches at least one task, and that each of
+// a variant's display tasks only contains tasks that run on the variant
+// and are not in any of its other display tasks.
+// All problems are reported together; each error is prefixed with the
+// path of the offending element, e.g. "buildvariants[ubuntu].tasks[lint]:
+// unknown task".
+func (c *Configuration) Validate() error {
+	return c.validate(false)
+}
+
+// ValidateFragment checks a configuration that is only part of a
+// project, such as a generate.tasks payload, for internal consistency.
+// It performs the same checks as Validate, except that references to
+// functions, tasks, task groups, build variants and modules that are
+// not defined in the configuration (and selectors that match none of
+// its tasks) are allowed, since they may be defined elsewhere in the
+// project or, for configurations produced by Split, in another of the
+// generate.tasks files.
+func (c *Configuration) ValidateFragment() error {
+	return c.validate(true)
+}
+
+func (c *Configuration) validate(fragment bool) error {
+	v := &validator{conf: c, fragment: fragment}
+
+	v.modules()
+	v.tasks()
+	v.groups()
+	v.variants()
+	v.functionCalls()
+	v.dependencyCycles()
+
+	return errors.Join(v.errs...)
+}
+
+type validator struct {
+	conf *Configuration
+	// fragment allows references to definitions outside of the
+	// configuration.
+	fragment bool
+	errs     []error
+}
+
+func (v *validator) add(path, msg string, args ...interface{}) {
+	v.errs = append(v.errs, fmt.Errorf("%s: %s", path, fmt.Sprintf(msg, args...)))
+}
+
+func (v *validator) modules() {
+	seen := map[string]bool{}
+	for idx, m := range v.conf.Modules {
+		if m == nil {
+			v.add(fmt.Sprintf("modules[%d]", idx), "module is nil")
+			continue
+		}
+		path := fmt.Sprintf("modules[%s]", m.ModuleName)
+		switch {
+		case m.ModuleName == "":
+			v.add(fmt.Sprintf("modules[%d]", idx), "module has no name")
+		case seen[m.ModuleName]:
+			v.add(path, "duplicate module definition")
+		}
+		seen[m.ModuleName] = true
+
+		if m.Repository == "" {
+			v.add(path, "module has no repo")
+		}
+		if m.BranchName == "" {
+			v.add(path, "module has no branch")
+		}
+	}
+}
+
+func (v *validator) tasks() {
+	seen := map[string]bool{}
+	for idx, t := range v.conf.Tasks {
+		if t == nil {
+			v.add(fmt.Sprintf("tasks[%d]", idx), "task is nil")
+			continue
+		}
+		path := fmt.Sprintf("tasks[%s]", t.Name)
+		switch {
+		case t.Name == "":
+			v.add(fmt.Sprintf("tasks[%d]", idx), "task has no name")
+		case seen[t.Name]:
+			v.add(path, "duplicate task definition")
+		}
+		seen[t.Name] = true
+
+		for _, dep := range t.Dependencies {
+			v.dependency(path, dep)
+		}
+	}
+}
+
+func (v *validator) groups() {
+	seen := map[string]bool{}
+	for idx, g := range v.conf.Groups {
+		if g == nil {
+			v.add(fmt.Sprintf("task_groups[%d]", idx), "task group is nil")
+			continue
+		}
+		path := fmt.Sprintf("task_groups[%s]", g.GroupName)
+		switch {
+		case g.GroupName == "":
+			v.add(fmt.Sprintf("task_groups[%d]", idx), "task group has no name")
+		case seen[g.GroupName]:
+			v.add(path, "duplicate task group definition")
+		case v.conf.findTask(g.GroupName) != nil:
+			v.add(path, "task group has the same name as a task")
+		}
+		seen[g.GroupName] = true
+
+		if len(g.Tasks) == 0 {
+			v.add(path, "task group has no tasks")
+		}
+		members := map[string]bool{}
+		for _, name := range g.Tasks {
+			if members[name] {
+				v.add(fmt.Sprintf("%s.tasks[%s]", path, name), "task listed more than once")
+			}
+			members[name] = true
+
+			if !v.fragment && v.conf.findTask(name) == nil {
+				v.add(fmt.Sprintf("%s.tasks[%s]", path, name), "unknown task")
+			}
+		}
+	}
+}
+
+func (v *validator) variants() {
+	seen := map[string]bool{}
+	for idx, bv := range v.conf.Variants {
+		if bv == nil {
+			v.add(fmt.Sprintf("buildvariants[%d]", idx), "build variant is nil")
+			continue
+		}
+		path := fmt.Sprintf("buildvariants[%s]", bv.BuildName)
+		switch {
+		case bv.BuildName == "":
+			v.add(fmt.Sprintf("buildvariants[%d]", idx), "build variant has no name")
+		case seen[bv.BuildName]:
+			v.add(path, "duplicate build variant definition")
+		}
+		seen[bv.BuildName] = true
+
+		for _, dep := range bv.DependsOn {
+			v.dependency(path, dep)
+		}
+
+		for _, name := range bv.Modules {
+			if !v.fragment && v.conf.findModule(name) == nil {
+				v.add(fmt.Sprintf("%s.modules[%s]", path, name), "unknown module")
+			}
+		}
+
+		specs := map[string]bool{}
+		for _, spec := range bv.TaskSpecs {
+			specPath := fmt.Sprintf("%s.tasks[%s]", path, spec.Name)
+			switch {
+			case spec.Name == "":
+				v.add(path, "task spec has no name")
+				continue
+			case specs[spec.Name]:
+				v.add(specPath, "task listed more than once")
+			}
+			specs[spec.Name] = true
+
+			switch {
+			case isTaskSelector(spec.Name):
+				if _, err := ParseSelector(spec.Name); err != nil {
+					v.add(specPath, "invalid selector: %s", err)
+				} else if !v.fragment && len(v.conf.selectorTasks(spec.Name)) == 0 {
+					v.add(specPath, "selector matches no tasks")
+				}
+			case spec.TaskGroup != nil:
+				if spec.TaskGroup.GroupName != "" && spec.TaskGroup.GroupName != spec.Name {
+					v.add(specPath, "inline task group is named '%s'", spec.TaskGroup.GroupName)
+				}
+			case !v.fragment && v.conf.findTask(spec.Name) == nil && v.conf.findGroup(spec.Name) == nil:
+				v.add(specPath, "unknown task")
+			}
+
+			for _, dep := range spec.DependsOn {
+				v.dependency(specPath, dep)
+			}
+		}
+
+		v.displayTasks(path, bv)
+	}
+}
+
+func (v *validator) displayTasks(path string, bv *Variant) {
+	runs := v.conf.variantTasks(bv)
+	owners := map[string]string{}
+	for _, dt := range bv.DisplayTaskSpecs {
+		dtPath := fmt.Sprintf("%s.display_tasks[%s]", path, dt.Name)
+		if dt.Name == "" {
+			v.add(path, "display task has no name")
+		}
+		if len(dt.Components) == 0 {
+			v.add(dtPath, "display task has no execution tasks")
+		}
+		for _, name := range dt.Components {
+			taskPath := fmt.Sprintf("%s.execution_tasks[%s]", dtPath, name)
+			switch owner, ok := owners[name]; {
+			case ok && owner == dt.Name:
+				v.add(taskPath, "task listed more than once")
+			case ok:
+				v.add(taskPath, "task is already in display task '%s'", owner)
+			case v.fragment:
+				// The task may be defined, and added to the variant,
+				// elsewhere in the project.
+				owners[name] = dt.Name
+			case v.conf.findTask(name) == nil:
+				v.add(taskPath, "unknown task")
+			case !containsString(runs, name):
+				v.add(taskPath, "task does not run on the build variant")
+			default:
+				owners[name] = dt.Name
+			}
+		}
+	}
+}
+
+func (v *validator) dependency(path string, dep TaskDependency) {
+	depPath := fmt.Sprintf("%s.depends_on[%s]", path, dep.Name)
+	switch {
+	case dep.Name == "":
+		v.add(path, "dependency has no name")
+	case dep.Name == "*", v.fragment:
+	case v.conf.findTask(dep.Name) == nil && v.conf.findGroup(dep.Name) == nil:
+		v.add(depPath, "unknown task")
+	}
+
+	if !v.fragment && dep.Variant != "" && dep.Variant != "*" && v.conf.findVariant(dep.Variant) == nil {
+		v.add(depPath, "unknown build variant '%s'", dep.Variant)
+	}
+}
+
+func (v *validator) dependencyCycles() {
+	for _, cycle := range NewDependencyGraph(v.conf).Cycles() {
+		v.add(fmt.Sprintf("buildvariants[%s].tasks[%s]", cycle[0].Variant, cycle[0].Task), "dependency cycle %s", formatCycle(cycle))
+	}
+}
+
+func (v *validator) functionCalls() {
+	for _, seq := range v.conf.commandSequences() {
+		for idx, cmd := range *seq.commands {
+			path := fmt.Sprintf("%s[%d]", seq.path, idx)
+			switch {
+			case cmd == nil:
+				v.add(path, "command is nil")
+			case cmd.FunctionName != "" && cmd.CommandName != "":
+				v.add(path, "cannot specify both a function and a command")
+			case cmd.FunctionName == "" && cmd.CommandName == "":
+				v.add(path, "must specify either a function or a command")
+			case cmd.FunctionName != "" && !v.fragment:
+				if _, ok := v.conf.Functions[cmd.FunctionName]; !ok {
+					v.add(path, "unknown function '%s'", cmd.FunctionName)
+				}
+			}
+		}
+	}
+}
+
+// namedSequence is a command sequence together with the path that
+// identifies it within a configuration.
+type namedSequence struct {
+	path string
+	// function is the name of the function, if the sequence is the
+	// body of a function.
+	function string
+	commands *CommandSequence
+}
+
+// commandSequences returns every command sequence defined in the
+// configuration in a stable order: functions (sorted by name), then the
+// project's pre, post and timeout commands, then task commands, then
+// the task group hooks, then the hooks of task groups defined inline in
+// build variant task specs. The sequences refer to the configuration's
+// own sequences, so they can be modified in place.
+func (c *Configuration) commandSequences() []namedSequence {
+	out := []namedSequence{}
+
+	names := make([]string, 0, len(c.Functions))
+	for name := range c.Functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if seq := c.Functions[name]; seq != nil {
+			out = append(out, namedSequence{path: fmt.Sprintf("functions[%s]", name), function: name, commands: seq})
+		}
+	}
+
+	out = append(out,
+		namedSequence{path: "pre", commands: &c.PreCommands},
+		namedSequence{path: "post", commands: &c.PostCommands},
+		namedSequence{path: "timeout", commands: &c.TimeoutCommands},
+	)
+
+	for _, t := range c.Tasks {
+		if t == nil {
+			continue
+		}
+		out = append(out, namedSequence{path: fmt.Sprintf("tasks[%s].commands", t.Name), commands: &t.Commands})
+	}
+
+	for _, g := range c.Groups {
+		if g == nil {
+			continue
+		}
+		out = append(out, groupSequences(fmt.Sprintf("task_groups[%s]", g.GroupName), g)...)
+	}
+
+	for _, v := range c.Variants {
+		if v == nil {
+			continue
+		}
+		for idx := range v.TaskSpecs {
+			spec := &v.TaskSpecs[idx]
+			if spec.TaskGroup == nil {
+				continue
+			}
+			prefix := fmt.Sprintf("buildvariants[%s].tasks[%s].task_group", v.BuildName, spec.Name)
+			out = append(out, groupSequences(prefix, spec.TaskGroup)...)
+		}
+	}
+
+	return out
+}
+
+// groupSequences returns the hooks of the task group, identified by
+// the prefix.
+func groupSequences(prefix string, g *TaskGroup) []namedSequence {
+	return []namedSequence{
+		{path: prefix + ".setup_group", commands: &g.SetupGroup},
+		{path: prefix + ".setup_task", commands: &g.SetupTask},
+		{path: prefix + ".teardown_task", commands: &g.TeardownTask},
+		{path: prefix + ".teardown_group", commands: &g.TeardownGroup},
+		{path: prefix + ".timeout", commands: &g.Timeout},
+	}
+}
+
+// isTaskSelector reports whether a task spec name is an Evergreen tag
+// selector (e.g. ".lint" or "!.slow") rather than a literal task name.
+func isTaskSelector(name string) bool {
+	return name == "*" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "!") || strings.Contains(name, " ")
+}
+
+func (c *Configuration) findTask(name string) *Task {
+	for _, t := range c.Tasks {
+		if t != nil && t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+func (c *Configuration) findGroup(name string) *TaskGroup {
+	for _, g := range c.Groups {
+		if g != nil && g.GroupName == name {
+			return g
+		}
+	}
+	return nil
+}
+
+func (c *Configuration) findVariant(name string) *Variant {
+	for _, v := range c.Variants {
+		if v != nil && v.BuildName == name {
+			return v
+		}
+	}
+	return nil
+}
+
+func (c *Configuration) findModule(name string) *Module {
+	for _, m := range c.Modules {
+		if m != nil && m.ModuleName == name {
+			return m
+		}
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package shrub
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestConfigurationValidate(t *testing.T) {
+	cases := map[string]struct {
+		build  func(*Configuration)
+		errors []string
+	}{
+		"Empty": {
+			build: func(c *Configuration) {},
+		},
+		"WellFormed": {
+			build: func(c *Configuration) {
+				c.Function("setup").Command().Command("git.get_project").Param("directory", "src")
+				c.Task("compile").Function("setup").Tag("lint")
+				c.Task("test").Function("setup").Dependency(TaskDependency{Name: "compile"})
+				c.TaskGroup("group").Task("compile", "test")
+				c.Variant("ubuntu").AddTasks("test", "group", ".lint").
+					DisplayTasks(DisplayTaskDefinition{Name: "all", Components: []string{"compile", "test"}})
+				c.Variant("windows").AddTasks("compile").TaskSpec(TaskSpec{
+					Name:      "test",
+					DependsOn: []TaskDependency{{Name: "compile", Variant: "ubuntu"}},
+				})
+			},
+		},
+		"UnknownTaskInVariant": {
+			build: func(c *Configuration) {
+				c.Variant("ubuntu").AddTasks("lint")
+			},
+			errors: []string{"buildvariants[ubuntu].tasks[lint]: unknown task"},
+		},
+		"Modules": {
+			build: func(c *Configuration) {
+				c.Module("tools").Repo("git@github.com:evergreen-ci/tools.git").Branch("main")
+				c.Module("docs").Repo("git@github.com:evergreen-ci/docs.git")
+				c.Modules = append(c.Modules, &Module{ModuleName: "tools", Repository: "r", BranchName: "b"})
+				c.Variant("ubuntu").Module("tools").Module("data")
+			},
+			errors: []string{
+				"modules[docs]: module has no branch",
+				"modules[tools]: duplicate module definition",
+				"buildvariants[ubuntu].modules[data]: unknown module",
+			},
+		},
+		"UnknownFunctionInPre": {
+			build: func(c *Configuration) {
+				c.Post().Append(&CommandDefinition{FunctionName: "cleanup"})
+			},
+			errors: []string{"post[0]: unknown function 'cleanup'"},
+		},
+		"InvalidSelector": {
+			build: func(c *Configuration) {
+				c.Task("compile").Tag("build")
+				c.Variant("ubuntu").AddTasks(".build", "!*")
+			},
+			errors: []string{"buildvariants[ubuntu].tasks[!*]: invalid selector"},
+		},
+		"EmptySelector": {
+			build: func(c *Configuration) {
+				c.Task("compile").Tag("build")
+				c.Variant("ubuntu").AddTasks(".build", ".lint", ".build !.build")
+			},
+			errors: []string{
+				"buildvariants[ubuntu].tasks[.lint]: selector matches no tasks",
+				"buildvariants[ubuntu].tasks[.build !.build]: selector matches no tasks",
+			},
+		},
+		"UnknownTaskInGroup": {
+			build: func(c *Configuration) {
+				c.TaskGroup("group").Task("missing")
+			},
+			errors: []string{"task_groups[group].tasks[missing]: unknown task"},
+		},
+		"EmptyGroup": {
+			build: func(c *Configuration) {
+				c.TaskGroup("group")
+			},
+			errors: []string{"task_groups[group]: task group has no tasks"},
+		},
+		"UnknownFunction": {
+			build: func(c *Configuration) {
+				c.Task("compile").Function("setup")
+				c.TaskGroup("group").Task("compile").SetupGroup.Append(&CommandDefinition{FunctionName: "teardown"})
+			},
+			errors: []string{
+				"tasks[compile].commands[0]: unknown function 'setup'",
+				"task_groups[group].setup_group[0]: unknown function 'teardown'",
+			},
+		},
+		"UnknownFunctionInInlineGroup": {
+			build: func(c *Configuration) {
+				c.Task("compile")
+				spec := TaskSpec{Name: "group"}
+				spec.SetTaskGroup(TaskGroup{
+					Tasks:        []string{"compile"},
+					TeardownTask: CommandSequence{{FunctionName: "teardown"}},
+				})
+				c.Variant("ubuntu").TaskSpec(spec)
+			},
+			errors: []string{"buildvariants[ubuntu].tasks[group].task_group.teardown_task[0]: unknown function 'teardown'"},
+		},
+		"MalformedCommands": {
+			build: func(c *Configuration) {
+				c.Function("setup").Command()
+				c.Task("compile").AddCommand().Function("setup").Command("shell.exec")
+			},
+			errors: []string{
+				"functions[setup][0]: must specify either a function or a command",
+				"tasks[compile].commands[0]: cannot specify both a function and a command",
+			},
+		},
+		"UnknownDependencies": {
+			build: func(c *Configuration) {
+				c.Task("test").Dependency(TaskDependency{Name: "compile"})
+				c.Variant("ubuntu").AddTasks("test").SetDependsOn(TaskDependency{Name: "test", Variant: "windows"})
+			},
+			errors: []string{
+				"tasks[test].depends_on[compile]: unknown task",
+				"buildvariants[ubuntu].depends_on[test]: unknown build variant 'windows'",
+			},
+		},
+		"WildcardDependencies": {
+			build: func(c *Configuration) {
+				c.Task("test").Dependency(TaskDependency{Name: "*", Variant: "*"})
+			},
+		},
+		"UnknownDisplayTaskComponent": {
+			build: func(c *Configuration) {
+				c.Task("test")
+				c.Variant("ubuntu").AddTasks("test").DisplayTasks(DisplayTaskDefinition{
+					Name:       "all",
+					Components: []string{"test", "lint"},
+				})
+			},
+			errors: []string{"buildvariants[ubuntu].display_tasks[all].execution_tasks[lint]: unknown task"},
+		},
+		"DisplayTaskComponentNotInVariant": {
+			build: func(c *Configuration) {
+				c.Task("test")
+				c.Task("lint")
+				c.Variant("ubuntu").AddTasks("test").DisplayTasks(DisplayTaskDefinition{
+					Name:       "all",
+					Components: []string{"test", "lint"},
+				})
+			},
+			errors: []string{"buildvariants[ubuntu].display_tasks[all].execution_tasks[lint]: task does not run on the build variant"},
+		},
+		"TaskInTwoDisplayTasks": {
+			build: func(c *Configuration) {
+				c.Task("test")
+				c.Task("lint")
+				c.Variant("ubuntu").AddTasks("test", "lint").DisplayTasks(
+					DisplayTaskDefinition{Name: "all", Components: []string{"test", "lint", "lint"}},
+					DisplayTaskDefinition{Name: "tests", Components: []string{"test"}},
+				)
+			},
+			errors: []string{
+				"buildvariants[ubuntu].display_tasks[all].execution_tasks[lint]: task listed more than once",
+				"buildvariants[ubuntu].display_tasks[tests].execution_tasks[test]: task is already in display task 'all'",
+			},
+		},
+		"Duplicates": {
+			build: func(c *Configuration) {
+				c.Tasks = append(c.Tasks, &Task{Name: "test"}, &Task{Name: "test"})
+				c.Variants = append(c.Variants, &Variant{BuildName: "ubuntu"}, &Variant{BuildName: "ubuntu"})
+			},
+			errors: []string{
+				"tasks[test]: duplicate task definition",
+				"buildvariants[ubuntu]: duplicate build variant definition",
+			},
+		},
+		"MissingNames": {
+			build: func(c *Configuration) {
+				c.Tasks = append(c.Tasks, &Task{})
+				c.Variant("").TaskSpec(TaskSpec{})
+			},
+			errors: []string{
+				"tasks[0]: task has no name",
+				"buildvariants[0]: build variant has no name",
+				"buildvariants[]: task spec has no name",
+			},
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			conf := &Configuration{}
+			test.build(conf)
+
+			err := conf.Validate()
+			if len(test.errors) == 0 {
+				assert(t, err == nil, "unexpected error:", errString(err))
+				return
+			}
+
+			require(t, err != nil, "expected validation errors")
+			var joined interface{ Unwrap() []error }
+			require(t, errors.As(err, &joined), "errors are aggregated")
+			assert(t, len(joined.Unwrap()) == len(test.errors), "error count:", err.Error())
+			for _, msg := range test.errors {
+				assert(t, strings.Contains(err.Error(), msg), "missing", msg, "in", err.Error())
+			}
+		})
+	}
+}
+
+func TestConfigurationValidateFragment(t *testing.T) {
+	t.Run("ParentReferences", func(t *testing.T) {
+		conf := &Configuration{}
+		conf.Task("shard_0").Function("setup").Dependency(TaskDependency{Name: "compile", Variant: "ubuntu"})
+		conf.TaskGroup("shards").Task("shard_0", "shard_1")
+		conf.Variant("windows").AddTasks("shard_0", "compile", ".lint").Module("enterprise").
+			DisplayTasks(DisplayTaskDefinition{Name: "tests", Components: []string{"shard_0", "lint"}})
+
+		assert(t, conf.Validate() != nil)
+		assert(t, conf.ValidateFragment() == nil, errString(conf.ValidateFragment()))
+	})
+	t.Run("InternalConsistency", func(t *testing.T) {
+		conf := &Configuration{}
+		conf.Tasks = append(conf.Tasks, &Task{Name: "test"}, &Task{Name: "test"})
+		conf.Task("compile").AddCommand().Function("setup").Command("shell.exec")
+		conf.Variant("ubuntu").AddTasks("test").
+			DisplayTasks(
+				DisplayTaskDefinition{Name: "all", Components: []string{"test"}},
+				DisplayTaskDefinition{Name: "other", Components: []string{"test"}},
+			)
+
+		err := conf.ValidateFragment()
+		require(t, err != nil)
+		for _, msg := range []string{
+			"tasks[test]: duplicate task definition",
+			"tasks[compile].commands[0]: cannot specify both a function and a command",
+			"buildvariants[ubuntu].display_tasks[other].execution_tasks[test]: task is already in display task 'all'",
+		} {
+			assert(t, strings.Contains(err.Error(), msg), "missing", msg, "in", err.Error())
+		}
+	})
+}
@@ -33,7 +33,7 @@ type TaskSpec struct {
 	Name     string `json:"name" yaml:"name"`
 	Stepback bool   `json:"stepback,omitempty" yaml:"stepback,omitempty"`
 	// Distro is deprecated in favor of RunOn.
-	Distro            []string         `json:"distros,omitempty" yaml:"distro,omitempty"`
+	Distro            []string         `json:"distros,omitempty" yaml:"distros,omitempty"`
 	RunOn             []string         `json:"run_on,omitempty" yaml:"run_on,omitempty"`
 	DependsOn         []TaskDependency `json:"depends_on,omitempty" yaml:"depends_on,omitempty"`
 	Priority          int              `json:"priority,omitempty" yaml:"priority,omitempty"`
@@ -196,6 +196,19 @@ func (v *Variant) AddTasks(name ...string) *Variant {
 	return v
 }
 
+// AddTaskSelector adds a task spec that selects tasks using an
+// Evergreen selector, such as ".lint !.slow". It panics if the selector
+// is not valid.
+func (v *Variant) AddTaskSelector(sel string) *Variant {
+	s, err := ParseSelector(sel)
+	if err != nil {
+		panic(err)
+	}
+
+	v.TaskSpecs = append(v.TaskSpecs, TaskSpec{Name: s.String()})
+	return v
+}
+
 func (v *Variant) DisplayTasks(def ...DisplayTaskDefinition) *Variant {
 	v.DisplayTaskSpecs = append(v.DisplayTaskSpecs, def...)
 	return v